@@ -22,7 +22,7 @@ var (
 // Authentication middleware
 type apiAuthentication struct {
 	wrappedHandler http.Handler
-	authKey        string
+	name           string // name of the manager, whose authentication key is looked up for each request
 }
 
 type apiMessage struct {
@@ -45,39 +45,55 @@ func rndKey() []byte {
 	return token
 }
 
+// apiSigningKey returns the key tokens are signed with for a manager with authKey
+func apiSigningKey(authKey string) []byte {
+	key := make([]byte, 0, len(APITokenSigningKey)+len(authKey))
+	key = append(key, APITokenSigningKey...)
+	return append(key, authKey...)
+}
+
 func (h apiAuthentication) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	cookie, _ := r.Cookie("session")
-	if cookie != nil {
-		token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
-			}
+	manager := getManager(h.name)
+	if manager == nil {
+		apiWriteData(w, 404, apiMessage{Success: false, Data: "Cluster node is not running"})
+		return
+	}
 
-			return APITokenSigningKey, nil
-		})
+	cookie, _ := r.Cookie("session")
+	if cookie == nil {
+		apiWriteData(w, 403, apiMessage{Success: false, Error: "Missing session token"})
+		return
+	}
 
-		if err != nil {
-			apiWriteData(w, 403, apiMessage{Success: false, Error: err.Error()})
-			return
+	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			if time.Now().Unix() > int64(claims["expire"].(float64)) {
-				apiWriteData(w, 403, apiMessage{Success: false, Error: "Token expired"})
-				return
-			}
+		return apiSigningKey(manager.authKey), nil
+	})
+
+	if err != nil {
+		apiWriteData(w, 403, apiMessage{Success: false, Error: err.Error()})
+		return
+	}
 
-			h.wrappedHandler.ServeHTTP(w, r)
-		} else {
-			apiWriteData(w, 403, apiMessage{Success: false, Error: err.Error()})
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if time.Now().Unix() > int64(claims["expire"].(float64)) {
+			apiWriteData(w, 403, apiMessage{Success: false, Error: "Token expired"})
 			return
 		}
+
+		h.wrappedHandler.ServeHTTP(w, r)
+	} else {
+		apiWriteData(w, 403, apiMessage{Success: false, Error: "Invalid token"})
+		return
 	}
 }
 
-// Authenticate user
-func authenticate(h http.Handler, authKey string) apiAuthentication {
-	return apiAuthentication{h, authKey}
+// Authenticate user with the authentication key of the manager with name
+func authenticate(h http.Handler, name string) apiAuthentication {
+	return apiAuthentication{h, name}
 }
 
 func apiMakeKey(username, key string, epoch int64) (string, error) {
@@ -87,7 +103,7 @@ func apiMakeKey(username, key string, epoch int64) (string, error) {
 	})
 
 	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString(APITokenSigningKey)
+	tokenString, err := token.SignedString(apiSigningKey(key))
 	if err != nil {
 		return "", err
 	}
@@ -1,32 +1,159 @@
 package cluster
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type apiClusterAdminHandler struct {
-	manager *Manager
+	name string // name of the manager
+}
+
+// apiAdminData is the optional post data of an admin request
+type apiAdminData struct {
+	Duration string `json:"duration"` // how long a node is down for admindown, e.g. "5m"
+	Addr     string `json:"addr"`     // address of the node for add and update
+	Cluster  bool   `json:"cluster"`  // apply add, remove and update on all nodes of the cluster
 }
 
 /*
 	Cluster Admin options:
-	  request in format: /api/cluster/[manager]/admin/[node]/action
+	  request in format: /api/v1/cluster/[manager]/admin/[node]/action
 			post data -> additional data in json format
+	  or: /api/v1/cluster/[manager]/admin/nodes to list the configured nodes and their address
 
 		internal options:
-	 	reconnect - reconnect to a node (disconnect, as it reconnects on timeout)
-	 	admindown - disconnect a node, and do not reconnect for duration
+	 	reconnect - disconnect a node, and dial it again right away
+	 	admindown - disconnect a node, and do not reconnect for duration, post data: {"duration": "5m"}
+	 	adminup - undo admindown, and dial the node again right away
 	 	reload - reload config - passed on to client application
+
+		node management, post data: {"addr": "10.0.0.1:9504", "cluster": true} to apply it on all nodes:
+		add - add a node to connect to
+		remove - remove a node, and close its connection
+		update - change the address of a node, and reconnect to it
+
+		other actions are passed on to the client application as well
 */
 
 func (h apiClusterAdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	path := strings.Split(strings.TrimLeft(r.URL.Path, "/api/v1/cluster/"), "/")
+	manager := getManager(h.name)
+	if manager == nil {
+		apiWriteData(w, 404, apiMessage{Success: false, Data: "Cluster node is not running"})
+		return
+	}
+
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/cluster/"), "/")
+	if len(path) == 3 && path[2] == "nodes" {
+		nodes := make(map[string]string)
+		for _, configured := range manager.getConfiguredNodes() {
+			nodes[configured.name] = configured.addr
+		}
+		apiWriteData(w, 200, apiMessage{Success: true, Data: nodes})
+		return
+	}
+
 	if len(path) != 4 {
 		apiWriteData(w, 501, apiMessage{Success: false, Data: "Unknown request parameters"})
 		return
 	}
 	node, action := path[2], path[3]
-	h.manager.internalMessage <- internalMessage{Type: "api" + action, Node: node}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiWriteData(w, 400, apiMessage{Success: false, Error: "Unable to read request: " + err.Error()})
+		return
+	}
+
+	data := &apiAdminData{}
+	switch action {
+	case "admindown", "add", "remove", "update":
+		if len(body) == 0 {
+			break
+		}
+		if err := json.Unmarshal(body, data); err != nil {
+			apiWriteData(w, 400, apiMessage{Success: false, Error: "Invalid post data: " + err.Error()})
+			return
+		}
+	}
+
+	if action == "add" {
+		switch {
+		case node == manager.name:
+			apiWriteData(w, 400, apiMessage{Success: false, Error: "Unable to add ourselves as node " + node})
+		case manager.NodeConfigured(node):
+			apiWriteData(w, 409, apiMessage{Success: false, Error: "Node " + node + " already exists"})
+		case data.Addr == "":
+			apiWriteData(w, 400, apiMessage{Success: false, Error: "Missing address of node " + node})
+		default:
+			if data.Cluster {
+				manager.AddNode(node, data.Addr)
+			} else {
+				manager.addNode(node, data.Addr)
+			}
+			apiWriteData(w, 200, apiMessage{Success: true, Data: action + " OK"})
+		}
+		return
+	}
+
+	if node != manager.name && !manager.NodeConfigured(node) {
+		apiWriteData(w, 404, apiMessage{Success: false, Error: "Unknown node " + node})
+		return
+	}
+
+	if node == manager.name && (action == "remove" || action == "update") {
+		apiWriteData(w, 400, apiMessage{Success: false, Error: "Unable to " + action + " ourselves as node " + node})
+		return
+	}
+
+	switch action {
+	case "remove":
+		if data.Cluster {
+			manager.RemoveNode(node)
+		} else {
+			manager.removeNode(node)
+		}
+
+	case "update":
+		if data.Addr == "" {
+			apiWriteData(w, 400, apiMessage{Success: false, Error: "Missing address of node " + node})
+			return
+		}
+		if data.Cluster {
+			manager.AddNode(node, data.Addr)
+		} else {
+			manager.addNode(node, data.Addr)
+		}
+		err = manager.Reconnect(node) // connect to the new address
+
+	case "reconnect":
+		err = manager.Reconnect(node)
+
+	case "admindown":
+		var duration time.Duration
+		duration, err = time.ParseDuration(data.Duration)
+		if err == nil {
+			err = manager.AdminDown(node, duration)
+		}
+
+	case "adminup":
+		err = manager.AdminUp(node)
+
+	default: // reload and others are passed on to the client application
+		select {
+		case manager.apiRequest <- APIRequest{Action: action, Manager: manager.name, Node: node, Data: string(body)}:
+		default:
+			apiWriteData(w, 503, apiMessage{Success: false, Error: "Cluster node is too busy to handle the request"})
+			return
+		}
+	}
+
+	if err != nil {
+		apiWriteData(w, 400, apiMessage{Success: false, Error: err.Error()})
+		return
+	}
 	apiWriteData(w, 200, apiMessage{Success: true, Data: action + " OK"})
 }
@@ -6,46 +6,84 @@ import (
 )
 
 type apiClusterPublicHandler struct {
-	manager *Manager
+	name string // name of the manager
 }
 
 // APIClusterNode contains details of a node we might connect to used for the API
 type APIClusterNode struct {
-	Name     string        `json:"name"`
-	Addr     string        `json:"addr"`
-	Status   string        `json:"status"`
-	Error    string        `json:"error"`
-	JoinTime time.Time     `json:"jointime"`
-	Lag      time.Duration `json:"lag"`
-	Packets  int64         `json:"packets"`
+	Name            string        `json:"name"`
+	Addr            string        `json:"addr"`
+	Status          string        `json:"status"`
+	Error           string        `json:"error"`
+	JoinTime        time.Time     `json:"jointime"`
+	Lag             time.Duration `json:"lag"`                   // one way latency, half the round trip time if the node supports it
+	RTT             time.Duration `json:"rtt,omitempty"`         // round trip time of the last ping
+	ClockOffset     time.Duration `json:"clockoffset,omitempty"` // estimated offset of the clock of the node to ours
+	ClockSkewed     bool          `json:"clockskewed,omitempty"` // true if the clock offset exceeds the maximum clock skew
+	Packets         int64         `json:"packets"`
+	UnknownTypes    int64         `json:"unknowntypes,omitempty"` // received messages of types not registered with RegisterType
+	ProtocolVersion int           `json:"protocolversion,omitempty"`
+	Version         string        `json:"version,omitempty"`
+	Capabilities    []string      `json:"capabilities,omitempty"`
+	Phi             float64       `json:"phi,omitempty"` // suspicion of the failure detector that the node failed
+	Connected       bool          `json:"connected"`     // true if we are connected to the node
+	Alive           bool          `json:"alive"`         // true if we, or other nodes we are connected to, are connected to the node
+	ConnectState    string        `json:"connectstate"`  // state of our connection to the node, one of the Connect states
+	NextRetry       time.Time     `json:"nextretry"`     // time of the next attempt to connect while in backoff
 }
 
 // APIClusterNodeList contains a list of configured/connected nodes used for the API
 type APIClusterNodeList struct {
-	Nodes map[string]APIClusterNode `json:"nodes"`
+	Nodes    map[string]APIClusterNode `json:"nodes"`
+	Draining bool                      `json:"draining"` // true if the node serving the API is draining
 }
 
 func (h apiClusterPublicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h.manager.RLock()
-	defer h.manager.RLock()
+	manager := getManager(h.name)
+	if manager == nil {
+		apiWriteData(w, 404, apiMessage{Success: false, Data: "Cluster node is not running"})
+		return
+	}
+
+	connected := manager.connectedNodes.snapshots(time.Now())
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
 	var message = &APIClusterNodeList{
-		Nodes: make(map[string]APIClusterNode),
+		Nodes:    make(map[string]APIClusterNode),
+		Draining: manager.draining,
 	}
 
-	for _, configured := range h.manager.configuredNodes {
+	for _, configured := range manager.configuredNodes {
 
 		n := APIClusterNode{
 			Name:   configured.name,
 			Addr:   configured.addr,
 			Status: configured.statusStr,
+			Error:  configured.errorStr,
+			Alive:  manager.liveness.isIndirect(configured.name),
 		}
+		n.ConnectState, n.NextRetry = manager.dialers.getState(configured.name)
 
-		if active, ok := h.manager.connectedNodes.nodes[configured.name]; ok {
+		if active, ok := connected[configured.name]; ok {
+			n.Connected = true
+			n.Alive = true
+			n.ConnectState = ConnectOnline
 			n.JoinTime = active.joinTime
 			n.Lag = active.lag
+			n.RTT = active.rtt
+			n.ClockOffset = active.offset
+			n.ClockSkewed = active.skewed
 			n.Packets = active.packets
+			n.UnknownTypes = active.unknown
 			n.Status = active.statusStr
 			n.Error = active.errorStr
+			n.ProtocolVersion = active.protocol
+			n.Version = active.library
+			n.Capabilities = active.capabilities
+			n.Phi = active.phi
+			if active.suspect {
+				n.Status = StatusSuspect
+			}
 		}
 		message.Nodes[configured.name] = n
 	}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -47,6 +48,76 @@ func TestApi(t *testing.T) {
 	}
 }
 
+func TestAPIAuthenticationKey(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := authenticate(ok, "managerAPIKey")
+	status := func(key string) int {
+		token, _ := apiMakeKey("Test", key, 0)
+		r := httptest.NewRequest("GET", "/api/v1/cluster/managerAPIKey/admin/nodes", nil)
+		r.AddCookie(&http.Cookie{Name: "session", Value: token})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := status("first"); code != 404 {
+		t.Errorf("expected 404 while the manager is not running, but got:%d", code)
+	}
+
+	manager := NewManager("managerAPIKey", "first")
+	if code := status("first"); code != 200 {
+		t.Errorf("expected a token of the key of the manager to be accepted, but got:%d", code)
+	}
+	removeManager(manager.name)
+
+	// a new manager with the same name and another key does not accept tokens of the old key
+	manager = NewManager("managerAPIKey", "second")
+	defer removeManager(manager.name)
+	if code := status("first"); code != 403 {
+		t.Errorf("expected a token of the previous key to be rejected, but got:%d", code)
+	}
+
+	if code := status("second"); code != 200 {
+		t.Errorf("expected a token of the new key to be accepted, but got:%d", code)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/cluster/managerAPIKey/admin/nodes", nil))
+	if w.Code != 403 {
+		t.Errorf("expected a request without a token to be rejected, but got:%d", w.Code)
+	}
+}
+
+func TestAPIClusterPublicConnected(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerAPIPublic", 2, func(settings *Settings) {
+		settings.PingInterval = 20 * time.Millisecond
+	})
+	handler := apiClusterPublicHandler{name: managers[0].name}
+	nodes := func() map[string]APIClusterNode {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/cluster/managerAPIPublic0/public", nil))
+		message := &apiReadMessage{}
+		clusterNodes := &APIClusterNodeList{}
+		if err := json.Unmarshal(w.Body.Bytes(), message); err != nil {
+			t.Fatalf("unable to parse output of the cluster API data:%s error:%s", w.Body.Bytes(), err)
+		}
+		if err := json.Unmarshal([]byte(message.Data), clusterNodes); err != nil {
+			t.Fatalf("unable to parse the node list of the cluster API data:%s error:%s", message.Data, err)
+		}
+		return clusterNodes.Nodes
+	}
+
+	// the nodes are read while pings and pongs update them
+	if !waitFor(5*time.Second, func() bool {
+		node := nodes()["managerAPIPublic1"]
+		return node.Connected && node.RTT > 0 && node.Packets > 10
+	}) {
+		t.Errorf("expected managerAPIPublic1 to be connected with its round trip time, but got:%+v", nodes()["managerAPIPublic1"])
+	}
+}
+
 func startHTTPServer(addr string) *http.Server {
 	srv := &http.Server{Addr: addr}
 	go func() {
@@ -214,4 +285,43 @@ func testAPIClusterAdmin(t *testing.T) {
 	}
 	//fmt.Printf("Got private data: %s", string(data))
 
+	// actions on unknown nodes fail
+	url = "/api/v1/cluster/managerAPI/admin/managerUnknown/reconnect"
+	_, statusCode, err = getWithKey(authKey, "http://"+httpAddr+url)
+	if err != nil {
+		t.Errorf("failed to get url, error:%s", err)
+	}
+
+	if statusCode != 404 {
+		t.Errorf("incorrect status code for %s expected:404, got:%d", url, statusCode)
+	}
+
+	// reload is passed on to the client application
+	url = "/api/v1/cluster/managerAPI/admin/managerAPI2/reload"
+	_, statusCode, err = getWithKey(authKey, "http://"+httpAddr+url)
+	if err != nil {
+		t.Errorf("failed to get url, error:%s", err)
+	}
+
+	if statusCode != 200 {
+		t.Errorf("incorrect status code for %s expected:200, got:%d", url, statusCode)
+	}
+
+	manager := getManager("managerAPI")
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case request := <-manager.FromClusterAPI:
+			if request.Action != "reload" {
+				continue // the shutdown request above
+			}
+			if request.Node != "managerAPI2" {
+				t.Errorf("expected reload of managerAPI2, but got:%+v", request)
+			}
+		case <-timeout:
+			t.Errorf("expected reload request on FromClusterAPI, but got timeout")
+		}
+		break
+	}
+
 }
@@ -0,0 +1,138 @@
+package cluster
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec encodes the packets sent over a connection, and the messages inside them
+// Codecs are negotiated per connection during the handshake. JSON, gob, msgpack
+// and protobuf are included, other formats can be added with RegisterCodec on
+// all nodes that should use them
+type Codec interface {
+	Name() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = struct {
+	sync.RWMutex
+	codec map[string]Codec
+	order []string // names in order of registration
+}{
+	codec: make(map[string]Codec),
+}
+
+func init() {
+	RegisterCodec(JSONCodec{})
+	RegisterCodec(GobCodec{})
+	RegisterCodec(MsgpackCodec{})
+	RegisterCodec(ProtobufCodec{})
+}
+
+// RegisterCodec makes a codec available for negotiation with other nodes, replacing a codec with the same name
+func RegisterCodec(codec Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.codec[codec.Name()]; !ok {
+		codecs.order = append(codecs.order, codec.Name())
+	}
+	codecs.codec[codec.Name()] = codec
+}
+
+func getCodec(name string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	codec, ok := codecs.codec[name]
+	return codec, ok
+}
+
+// codecNames returns the names of all registered codecs, starting with preferred
+func codecNames(preferred string) []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	names := []string{preferred}
+	for _, name := range codecs.order {
+		if name != preferred {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// JSONCodec encodes using encoding/json
+type JSONCodec struct{}
+
+// Name returns the name of the codec
+func (JSONCodec) Name() string { return "json" }
+
+// Marshal encodes v
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal decodes data in to v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobCodec encodes using encoding/gob, messages without exported fields are sent empty
+type GobCodec struct{}
+
+// Name returns the name of the codec
+func (GobCodec) Name() string { return "gob" }
+
+// Marshal encodes v
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	if !hasExportedFields(v) {
+		return nil, nil
+	}
+
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(v)
+	return buffer.Bytes(), err
+}
+
+// Unmarshal decodes data in to v
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// hasExportedFields returns false for structs gob is unable to encode
+func hasExportedFields(v interface{}) bool {
+	val := reflect.Indirect(reflect.ValueOf(v))
+	if !val.IsValid() {
+		return false
+	}
+
+	if val.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < val.NumField(); i++ {
+		if val.Type().Field(i).PkgPath == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeMessage decodes the message of a packet encoded with codec
+func decodeMessage(codec string, data string, message interface{}) error {
+	if codec == "" || codec == "json" {
+		return json.Unmarshal(json.RawMessage(data), &message)
+	}
+
+	c, ok := getCodec(codec)
+	if !ok {
+		return fmt.Errorf("unknown codec: %s", codec)
+	}
+
+	return c.Unmarshal([]byte(data), message)
+}
@@ -0,0 +1,29 @@
+package cluster
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MsgpackCodec encodes using MessagePack, with the json tags of the fields as their names
+type MsgpackCodec struct{}
+
+// Name returns the name of the codec
+func (MsgpackCodec) Name() string { return "msgpack" }
+
+// Marshal encodes v
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := msgpack.NewEncoder(&buffer)
+	encoder.SetCustomStructTag("json")
+	err := encoder.Encode(v)
+	return buffer.Bytes(), err
+}
+
+// Unmarshal decodes data in to v
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+	return decoder.Decode(v)
+}
@@ -0,0 +1,148 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ProtobufCodec encodes messages implementing proto.Message using protocol
+// buffers. Packet headers are encoded as a protobuf message with the fields of
+// Packet, other messages such as the internal packets of the cluster are
+// encoded as JSON
+type ProtobufCodec struct{}
+
+// Name returns the name of the codec
+func (ProtobufCodec) Name() string { return "protobuf" }
+
+// Marshal encodes v
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	switch message := v.(type) {
+	case proto.Message:
+		return proto.Marshal(message)
+	case Packet:
+		return marshalPacketHeader(&message)
+	case *Packet:
+		return marshalPacketHeader(message)
+	}
+
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data in to v
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	switch message := v.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, message)
+	case *Packet:
+		return unmarshalPacketHeader(data, message)
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// field numbers of a packet header encoded with protobuf
+const (
+	packetFieldName protowire.Number = iota + 1
+	packetFieldDataType
+	packetFieldDataMessage
+	packetFieldTime // google.protobuf.Timestamp
+	packetFieldRequestID
+	packetFieldResponse
+	packetFieldError
+	packetFieldSequence
+	packetFieldTopic
+	packetFieldCompression
+)
+
+func marshalPacketHeader(packet *Packet) ([]byte, error) {
+	var data []byte
+	appendString := func(field protowire.Number, value string) {
+		if value != "" {
+			data = protowire.AppendTag(data, field, protowire.BytesType)
+			data = protowire.AppendString(data, value)
+		}
+	}
+
+	appendString(packetFieldName, packet.Name)
+	appendString(packetFieldDataType, packet.DataType)
+	appendString(packetFieldDataMessage, packet.DataMessage)
+	if !packet.Time.IsZero() {
+		timestamp, err := proto.Marshal(timestamppb.New(packet.Time))
+		if err != nil {
+			return nil, err
+		}
+		data = protowire.AppendTag(data, packetFieldTime, protowire.BytesType)
+		data = protowire.AppendBytes(data, timestamp)
+	}
+	appendString(packetFieldRequestID, packet.RequestID)
+	if packet.Response {
+		data = protowire.AppendTag(data, packetFieldResponse, protowire.VarintType)
+		data = protowire.AppendVarint(data, protowire.EncodeBool(packet.Response))
+	}
+	appendString(packetFieldError, packet.Error)
+	if packet.Sequence != 0 {
+		data = protowire.AppendTag(data, packetFieldSequence, protowire.VarintType)
+		data = protowire.AppendVarint(data, packet.Sequence)
+	}
+	appendString(packetFieldTopic, packet.Topic)
+	appendString(packetFieldCompression, packet.Compression)
+	return data, nil
+}
+
+func unmarshalPacketHeader(data []byte, packet *Packet) error {
+	for len(data) > 0 {
+		field, fieldType, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var value []byte
+		var number uint64
+		switch fieldType {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			number, n = protowire.ConsumeVarint(data)
+		default:
+			n = protowire.ConsumeFieldValue(field, fieldType, data)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch field {
+		case packetFieldName:
+			packet.Name = string(value)
+		case packetFieldDataType:
+			packet.DataType = string(value)
+		case packetFieldDataMessage:
+			packet.DataMessage = string(value)
+		case packetFieldTime:
+			timestamp := &timestamppb.Timestamp{}
+			if err := proto.Unmarshal(value, timestamp); err != nil {
+				return fmt.Errorf("invalid time: %s", err)
+			}
+			packet.Time = timestamp.AsTime()
+		case packetFieldRequestID:
+			packet.RequestID = string(value)
+		case packetFieldResponse:
+			packet.Response = protowire.DecodeBool(number)
+		case packetFieldError:
+			packet.Error = string(value)
+		case packetFieldSequence:
+			packet.Sequence = number
+		case packetFieldTopic:
+			packet.Topic = string(value)
+		case packetFieldCompression:
+			packet.Compression = string(value)
+		}
+	}
+
+	return nil
+}
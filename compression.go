@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compressor compresses the messages of large packets
+// Nodes advertise the compressors they support during the handshake, and only
+// use a compressor the remote node supports. gzip, zstd and snappy are
+// included, RegisterCompressor adds others
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var compressors = struct {
+	sync.RWMutex
+	compressor map[string]Compressor
+}{
+	compressor: make(map[string]Compressor),
+}
+
+func init() {
+	RegisterCompressor(GzipCompressor{})
+	RegisterCompressor(ZstdCompressor{})
+	RegisterCompressor(SnappyCompressor{})
+}
+
+// RegisterCompressor makes a compressor available to other nodes, replacing a compressor with the same name
+func RegisterCompressor(compressor Compressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+	compressors.compressor[compressor.Name()] = compressor
+}
+
+func getCompressor(name string) (Compressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	compressor, ok := compressors.compressor[name]
+	return compressor, ok
+}
+
+// compressorNames returns the names of all registered compressors
+func compressorNames() (names []string) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+	for name := range compressors.compressor {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return
+}
+
+// GzipCompressor compresses using compress/gzip
+type GzipCompressor struct{}
+
+// Name returns the name of the compressor
+func (GzipCompressor) Name() string { return "gzip" }
+
+// Compress compresses data
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Decompress decompresses data, up to MaxFrameSize bytes
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readLimited(reader)
+}
+
+// zstdEncoder is shared by all messages, EncodeAll can be used concurrently
+var zstdEncoder struct {
+	sync.Once
+	*zstd.Encoder
+	err error
+}
+
+// ZstdCompressor compresses using zstd
+type ZstdCompressor struct{}
+
+// Name returns the name of the compressor
+func (ZstdCompressor) Name() string { return "zstd" }
+
+// Compress compresses data
+func (ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	zstdEncoder.Do(func() {
+		zstdEncoder.Encoder, zstdEncoder.err = zstd.NewWriter(nil)
+	})
+	if zstdEncoder.err != nil {
+		return nil, zstdEncoder.err
+	}
+
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+// Decompress decompresses data, up to MaxFrameSize bytes
+func (ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readLimited(reader)
+}
+
+// SnappyCompressor compresses using the snappy block format
+type SnappyCompressor struct{}
+
+// Name returns the name of the compressor
+func (SnappyCompressor) Name() string { return "snappy" }
+
+// Compress compresses data
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress decompresses data, up to MaxFrameSize bytes
+func (SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	length, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if length > MaxFrameSize {
+		return nil, fmt.Errorf("decompressed message exceeds the maximum of %d bytes", MaxFrameSize)
+	}
+
+	return snappy.Decode(nil, data)
+}
+
+// readLimited reads all data of reader, failing if it exceeds MaxFrameSize
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(MaxFrameSize)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > MaxFrameSize {
+		return nil, fmt.Errorf("decompressed message exceeds the maximum of %d bytes", MaxFrameSize)
+	}
+
+	return data, nil
+}
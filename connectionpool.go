@@ -11,7 +11,8 @@ import (
 
 type connectionPool struct {
 	sync.RWMutex
-	nodes map[string]*Node
+	nodes  map[string]*Node
+	closed bool // set once all connections are closed on shutdown, no nodes are added after
 }
 
 func newConnectionPool() *connectionPool {
@@ -24,6 +25,10 @@ func newConnectionPool() *connectionPool {
 func (c *connectionPool) nodeAdd(newNode *Node) (*Node, error) {
 	c.Lock()
 	defer c.Unlock()
+	if c.closed {
+		return nil, fmt.Errorf("connection pool is closed, not adding node %s", newNode.name)
+	}
+
 	// Check if node does not exist
 	if node, ok := c.nodes[newNode.name]; ok {
 		return node, fmt.Errorf("Node %s already exists in connection pool add(%s->%s) existing(%s->%s)", newNode.name, newNode.conn.LocalAddr(), newNode.conn.RemoteAddr(), node.conn.LocalAddr(), node.conn.RemoteAddr())
@@ -33,10 +38,11 @@ func (c *connectionPool) nodeAdd(newNode *Node) (*Node, error) {
 	return nil, nil
 }
 
+// nodeRemove removes the connection of a node, unless it was replaced by another connection of the node
 func (c *connectionPool) nodeRemove(newNode *Node) error {
 	c.Lock()
 	defer c.Unlock()
-	if _, ok := c.nodes[newNode.name]; ok {
+	if node, ok := c.nodes[newNode.name]; ok && node == newNode {
 		delete(c.nodes, newNode.name)
 	}
 
@@ -53,6 +59,27 @@ func (c *connectionPool) nodeExists(name string) bool {
 	return false
 }
 
+func (c *connectionPool) nodeNames() (names []string) {
+	c.RLock()
+	defer c.RUnlock()
+	for name := range c.nodes {
+		names = append(names, name)
+	}
+
+	return
+}
+
+// hasCapability returns true if the connected node advertised capability
+func (c *connectionPool) hasCapability(name, capability string) bool {
+	c.RLock()
+	defer c.RUnlock()
+	if node, ok := c.nodes[name]; ok {
+		return node.version.capabilities[capability]
+	}
+
+	return false
+}
+
 func (c *connectionPool) getSocket(name string) (net.Conn, error) {
 	c.RLock()
 	defer c.RUnlock()
@@ -63,21 +90,28 @@ func (c *connectionPool) getSocket(name string) (net.Conn, error) {
 	return nil, fmt.Errorf("node not found: %s", name)
 }
 
-func (c *connectionPool) getAllSockets() (conns []net.Conn) {
+func (c *connectionPool) getNode(name string) (*Node, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	node, ok := c.nodes[name]
+	return node, ok
+}
+
+func (c *connectionPool) getAllNodes() (nodes []*Node) {
 	c.RLock()
 	defer c.RUnlock()
 	for _, node := range c.nodes {
-		conns = append(conns, node.conn)
+		nodes = append(nodes, node)
 	}
 
 	return
 }
 
-func (c *connectionPool) writeAll(p []byte) error {
+func (c *connectionPool) writeAll(packet *Packet) error {
 	var errors []string
-	conns := c.getAllSockets()
-	for _, conn := range conns {
-		err := c.writeSocket(conn, p)
+	encoded := newEncodedPacket(packet)
+	for _, node := range c.getAllNodes() {
+		err := node.writeEncoded(encoded)
 		if err != nil { // collect errors, try to send to the others
 			errors = append(errors, err.Error())
 		}
@@ -90,13 +124,20 @@ func (c *connectionPool) writeAll(p []byte) error {
 	return nil
 }
 
-func (c *connectionPool) write(name string, p []byte) error {
-	conn, err := c.getSocket(name)
-	if err != nil {
-		return fmt.Errorf("write failed: %s", err)
+func (c *connectionPool) write(name string, packet *Packet) error {
+	return c.writeEncoded(name, newEncodedPacket(packet))
+}
+
+// writeEncoded writes a packet that may be shared with the writes to other nodes
+func (c *connectionPool) writeEncoded(name string, packet *encodedPacket) error {
+	c.RLock()
+	node, ok := c.nodes[name]
+	c.RUnlock()
+	if !ok {
+		return fmt.Errorf("write failed: node not found: %s", name)
 	}
 
-	err = c.writeSocket(conn, p)
+	err := node.writeEncoded(packet)
 	if err != nil {
 		return fmt.Errorf("write failed: %s", err)
 	}
@@ -114,9 +155,9 @@ func (c *connectionPool) writeSocket(conn net.Conn, p []byte) error {
 	return nil
 }
 
-func (c *connectionPool) readSocket(conn net.Conn) (*Packet, error) {
+// readSocket reads a packet in the JSON newline format, used during the handshake
+func (c *connectionPool) readSocket(conn net.Conn, reader *bufio.Reader) (*Packet, error) {
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
-	reader := bufio.NewReader(conn)
 	bytes, err := reader.ReadBytes('\n')
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from socket: %s", err)
@@ -133,6 +174,7 @@ func (c *connectionPool) readSocket(conn net.Conn) (*Packet, error) {
 func (c *connectionPool) closeAll() {
 	c.Lock()
 	defer c.Unlock()
+	c.closed = true
 	for _, node := range c.nodes {
 		node.close()
 	}
@@ -154,6 +196,45 @@ func (c *connectionPool) setLag(name string, lag time.Duration) {
 	}
 }
 
+// addClockSample records a round trip measurement, and returns the round trip time and estimated clock offset of the node
+func (c *connectionPool) addClockSample(name string, sample clockSample) (time.Duration, time.Duration, bool) {
+	c.Lock()
+	defer c.Unlock()
+	node, ok := c.nodes[name]
+	if !ok {
+		return 0, 0, false
+	}
+
+	node.samples = append(node.samples, sample)
+	if len(node.samples) > clockSamples {
+		node.samples = node.samples[1:]
+	}
+
+	best := node.samples[0]
+	for _, s := range node.samples {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+
+	node.rtt = sample.rtt
+	node.lag = sample.rtt / 2
+	node.offset = best.offset
+	return node.rtt, node.offset, true
+}
+
+// setSkewed marks the clock of a node as skewed, returns true if this changed
+func (c *connectionPool) setSkewed(name string, skewed bool) bool {
+	c.Lock()
+	defer c.Unlock()
+	if node, ok := c.nodes[name]; ok && node.skewed != skewed {
+		node.skewed = skewed
+		return true
+	}
+
+	return false
+}
+
 func (c *connectionPool) incPackets(name string) {
 	c.Lock()
 	defer c.Unlock()
@@ -162,6 +243,14 @@ func (c *connectionPool) incPackets(name string) {
 	}
 }
 
+func (c *connectionPool) incUnknownTypes(name string) {
+	c.Lock()
+	defer c.Unlock()
+	if node, ok := c.nodes[name]; ok {
+		node.unknown++
+	}
+}
+
 func (c *connectionPool) setStatus(name, status string) {
 	c.Lock()
 	defer c.Unlock()
@@ -170,6 +259,37 @@ func (c *connectionPool) setStatus(name, status string) {
 	}
 }
 
+// heartbeat records the arrival of a ping of node for the failure detector
+func (c *connectionPool) heartbeat(name string, now time.Time) {
+	c.RLock()
+	defer c.RUnlock()
+	if node, ok := c.nodes[name]; ok && node.detector != nil {
+		node.detector.heartbeat(now)
+	}
+}
+
+// setSuspect marks a node as suspected to have failed, returns true if this changed
+func (c *connectionPool) setSuspect(name string, suspect bool) bool {
+	c.Lock()
+	defer c.Unlock()
+	if node, ok := c.nodes[name]; ok && node.suspect != suspect {
+		node.suspect = suspect
+		return true
+	}
+
+	return false
+}
+
+func (c *connectionPool) getStatus(name string) string {
+	c.RLock()
+	defer c.RUnlock()
+	if node, ok := c.nodes[name]; ok {
+		return node.statusStr
+	}
+
+	return ""
+}
+
 func (c *connectionPool) setStatusError(name, err string) {
 	c.Lock()
 	defer c.Unlock()
@@ -178,6 +298,54 @@ func (c *connectionPool) setStatusError(name, err string) {
 	}
 }
 
+// nodeSnapshot is a copy of the state of a connected node
+type nodeSnapshot struct {
+	joinTime     time.Time
+	lag          time.Duration
+	rtt          time.Duration
+	offset       time.Duration
+	skewed       bool
+	suspect      bool
+	phi          float64
+	packets      int64
+	unknown      int64
+	statusStr    string
+	errorStr     string
+	protocol     int
+	library      string
+	capabilities []string
+}
+
+// snapshots returns a copy of the state of all connected nodes
+func (c *connectionPool) snapshots(now time.Time) map[string]nodeSnapshot {
+	c.RLock()
+	defer c.RUnlock()
+	snapshots := make(map[string]nodeSnapshot)
+	for name, node := range c.nodes {
+		snapshot := nodeSnapshot{
+			joinTime:     node.joinTime,
+			lag:          node.lag,
+			rtt:          node.rtt,
+			offset:       node.offset,
+			skewed:       node.skewed,
+			suspect:      node.suspect,
+			packets:      node.packets,
+			unknown:      node.unknown,
+			statusStr:    node.statusStr,
+			errorStr:     node.errorStr,
+			protocol:     node.version.protocol,
+			library:      node.version.library,
+			capabilities: node.version.capabilityList(),
+		}
+		if node.detector != nil {
+			snapshot.phi = node.detector.phi(now)
+		}
+		snapshots[name] = snapshot
+	}
+
+	return snapshots
+}
+
 func (c *connectionPool) count() int {
 	c.Lock()
 	defer c.Unlock()
@@ -25,3 +25,24 @@ func TestConnectionPool(t *testing.T) {
 	}
 
 }
+
+func TestConnectionPoolReplacedNode(t *testing.T) {
+	pool := newConnectionPool()
+	oldNode := &Node{name: "node1"}
+	newNode := &Node{name: "node1"}
+
+	pool.nodeAdd(oldNode)
+	pool.nodeRemove(oldNode)
+	pool.nodeAdd(newNode)
+
+	// the old connection ending late must not remove the connection that replaced it
+	pool.nodeRemove(oldNode)
+	if !pool.nodeExists("node1") {
+		t.Errorf("expected node1 to stay in the connectionPool after removing the connection it replaced")
+	}
+
+	pool.nodeRemove(newNode)
+	if pool.nodeExists("node1") {
+		t.Errorf("expected node1 to be removed from the connectionPool")
+	}
+}
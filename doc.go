@@ -18,16 +18,178 @@ using this cluster library.
 This interface allows you to send data to the cluster, which will be
 broadcasted across the connected nodes.
 
+ err := manager.Send(ctx, "node2", Message{})           // send data to node2, and return the write error
+ results, err := manager.Broadcast(ctx, Message{})      // send data to all connected nodes, with the write error per configured node
+
+Send and Broadcast return once the data was written or ctx is done, instead of
+logging write errors like the channels do. A write aborted because ctx is done
+closes the connection, data is never written after they returned
+
+ manager.Handle(Message{}, func(from string, msg *Message) {...}) // handle received messages of a type
+
+Messages with a registered handler are decoded and passed to the handler on a
+pool of HandlerWorkers workers instead of the FromCluster channel. Messages of
+a node are handled in the order they were received
+
+ cluster.RegisterType("myapp.Message", Message{}, "main.Message") // send Message as myapp.Message, and accept its old name
+
+Messages are sent with the Go type path of their type as DataType, unless the
+type was registered with a stable name. Received aliases are replaced with the
+registered name, and with Settings.StrictTypes messages of unregistered types
+are dropped. Messages of unregistered types are counted per node in the
+cluster API, and reported as an UnknownTypeEvent{} on manager.UnknownType
+
+ manager.ToClusterReliable <- interface{} // send data to the cluster, with acknowledged delivery
+
+Data sent to ToClusterReliable is kept until each configured node acknowledged
+it, and is resent to nodes that reconnect. Duplicates are suppressed by the
+receiving node, which will not drop these packets when its channels are full.
+They are acknowledged once their handler returned, or they were read from
+FromCluster.
+
  state := <- manager.QuorumState // bool returning current quorum state, will update on node join/leave
  node := <- manager.NodeJoin  // string of node joining the cluster
  node := <- manager.NodeLeave // string of node leaving the cluster
+ leader := <- manager.LeaderChange // string of the new cluster leader, empty if there is none
+
+These channels are available to read additional cluster status updates.
+While the cluster has quorum, a leader is elected amongst the connected nodes,
+which can be queried using manager.Leader() and manager.IsLeader()
+
+ manager.HandleCall("main.Request", func(packet Packet) (interface{}, error) {...}) // handle requests of a data type
+ err := manager.Call(ctx, "node2", Request{}, &Response{}) // send a request to node2 and wait for its response
+
+Requests sent with Call are answered by the handler registered for the data
+type on the remote node, and wait for the response until ctx is done
+
+ manager.Put("key", []byte("value")) // set a key on all nodes of the cluster
+ value, ok := manager.Get("key")     // get a key from the local copy
+ events := manager.Watch("prefix/")  // receive KVEvent{} for changes to keys starting with prefix
+
+The replicated key/value store keeps a copy of all keys on each node. Writes
+are versioned so concurrent writes converge, and nodes exchange their full
+state when they join the cluster
+
+ lease, err := manager.Lock(ctx, "job", 10*time.Second) // acquire a lock on the cluster
+ err = lease.Renew(ctx, 10*time.Second)                 // keep the lock for another 10 seconds
+ err = lease.Unlock(ctx)                                // release the lock
+
+Locks are granted by the leader while the cluster has quorum, and released
+when the holder leaves the cluster. Each lease has a fencing token
+(lease.Token) that increases with every grant. Locks are replicated through
+the key/value store under the cluster.lock. prefix, so leases and tokens
+survive a change of leader. Keys with this prefix are reserved, Put and Delete
+refuse them, and Get and Watch do not return them
+
+ messages := manager.Subscribe("jobs")      // receive Packet{} published to the jobs topic
+ err := manager.Publish("jobs", Message{}) // send a message to all subscribers of jobs
+
+Nodes advertise the topics they subscribed to, so published messages are only
+sent to the nodes that subscribed
+
+ err := manager.SendStream(ctx, "node2", file) // send all data of an io.Reader to node2
+ stream := <-manager.Streams                   // receive a Stream{} sent to us, read it as an io.Reader
+
+Streams are sent in chunks between other packets, checked for integrity, and
+resumed when the connection to the node is restored
 
-These channels are available to read additional cluster status updates
+ manager.AddNode("node2", "127.0.0.1:9505") // add a node to the cluster, shared with all nodes
+ nodes := manager.NodesConfigured()          // the membership of the cluster
+
+The cluster membership is shared between nodes using gossip, a new node only
+needs to be configured with a single seed node to learn all other nodes
+
+ err := manager.ListenAndServeTransport("node1", network) // listen and connect using a custom Transport
+
+Connections between nodes are made using a Transport, TCPTransport and
+TLSTransport are used by ListenAndServe and ListenAndServeTLS. A
+MemoryNetwork connects nodes within the same process, for simulating
+clusters in tests
+
+ cluster.RegisterCodec(myCodec{}) // make your own Codec available to other nodes
+ settings.Codec = "msgpack"       // prefer msgpack for connections made by this node
+
+Packets are sent in length prefixed binary frames, encoded with a Codec
+negotiated per connection. JSON, gob, msgpack and protobuf are included, nodes
+with an empty Settings.Codec use the JSON newline format for compatibility.
+The protobuf codec encodes messages implementing proto.Message, other messages
+are sent as JSON.
+Messages of at least Settings.CompressionSize bytes are compressed with
+Settings.Compression if the remote node supports it, and decompressed before
+they are received. A packet sent to several nodes is compressed once. gzip,
+zstd and snappy are included
+
+Nodes exchange their ProtocolVersion, LibraryVersion and capabilities when
+they connect, and reject nodes older than MinProtocolVersion. The reason is
+shown as the Error of the node in the cluster API once the node proved it
+knows the key. Features are only used with nodes that advertised them, so a
+cluster can be upgraded node by node. This does not apply to nodes from before
+the challenge/response handshake, which are rejected, a cluster of those nodes
+has to be upgraded all at once
+
+ err := manager.ListenAndServe("127.0.0.1:9504") // start the cluster node
+ err = manager.Run(ctx)                           // block until ctx is done, then shut down the node
+ err = manager.Shutdown(ctx)                      // or shut down the node directly
+
+Shutdown sends the messages still queued on the channels, informs the other
+nodes, and waits until all goroutines of the node exited or ctx is done. A
+node can only be started and shut down once, create a new manager to start it
+again
+
+ manager.Drain()               // inform the cluster we are about to leave
+ node := <-manager.NodeDrain // string of a node draining before it leaves
+
+A draining node hands over the leadership of the cluster, and is shown with
+StatusDraining in the cluster API, so work can be moved away from it before it
+shuts down
+
+Nodes ping each other every Settings.PingInterval. A phi accrual failure
+detector learns the intervals between the pings of each node, and marks a
+node as StatusSuspect once its phi exceeds Settings.SuspicionThreshold. The
+node is disconnected when its phi exceeds Settings.FailureThreshold, or when
+nothing was received for Settings.ReadTimeout. Pauses up to
+Settings.AcceptablePause raise little suspicion. With the defaults a node that
+stops pinging is suspect after about 7.5 seconds, and disconnected after about
+9.5 seconds
+
+When the connection to a node is lost, other connected nodes are asked to
+probe it first. It is only reported on NodeLeave if none of them can reach it,
+so a single broken link does not make a node leave the cluster. The cluster
+API shows both if we are connected to a node, and if it is alive in the
+cluster
+
+ event := <-manager.ClockSkew // ClockSkewEvent{} of a node with a clock differing from ours
+
+Nodes answer each ping with a pong, which gives the round trip time and the
+offset of the clock of the node, both shown in the cluster API. A
+ClockSkewEvent is sent once the offset exceeds Settings.MaxClockSkew
+
+Each node we are not connected to is dialed on its own. Failed attempts are
+retried with an exponential backoff from Settings.ConnectInterval up to
+Settings.MaxBackoff, with jitter. The connection state of each node and the
+time of its next attempt are shown in the cluster API
 
  request := <-manager.FromClusterApi // recieve APIRequest{} send via the API interface by a client
 
 With APIEnabled you can recieve API requests though an authenticated web interface
 
+ /api/v1/cluster/[manager]/admin/[node]/[action] // reconnect, admindown, adminup, or passed on to FromClusterAPI
+
+The admin actions are also available as Reconnect, AdminDown and AdminUp. A
+node that is admin down is disconnected, and connections to and from it are
+refused until the duration passed as {"duration": "5m"} expires
+
+ /api/v1/cluster/[manager]/admin/[node]/add    // {"addr": "10.0.0.1:9504", "cluster": true}
+ /api/v1/cluster/[manager]/admin/[node]/update // {"addr": "10.0.0.2:9504", "cluster": true}
+ /api/v1/cluster/[manager]/admin/[node]/remove // {"cluster": true}
+ /api/v1/cluster/[manager]/admin/nodes         // list the configured nodes and their address
+
+Nodes can be added, updated and removed at runtime through the admin API. With
+"cluster" set the change is shared with all nodes of the cluster like AddNode
+and RemoveNode, otherwise it only applies to the node serving the request. An
+update only changes the address of the node, nodes connected to it reconnect
+to the new address
+
  log := <-manager.Log // recieve Logging from the debug package
 
 Read the Log channel to receive cluster wide logging
@@ -0,0 +1,146 @@
+package cluster
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Failures are detected with a phi accrual failure detector, fed by the
+// arrival times of the pings of each node. It keeps a window of the intervals
+// between pings, and expresses the suspicion that a node failed as phi, the
+// -log10 of the probability that the next ping is still on its way given the
+// time since the last ping. A phi of 8 means a chance of 1 in 10^8 that a ping
+// would still arrive. This adapts to the latency and jitter of the network,
+// unlike a fixed timeout.
+//
+// Settings.AcceptablePause is added to the mean interval, so a pause of the
+// node or network shorter than that (e.g. garbage collection) raises little
+// suspicion. A node with a phi above Settings.SuspicionThreshold is marked as
+// suspect, and disconnected once its phi exceeds Settings.FailureThreshold.
+// With the default settings a node missing its pings is suspect for a few
+// seconds before it is disconnected.
+
+var (
+	// FailureDetectorWindow is the number of ping intervals the failure detector remembers per node
+	FailureDetectorWindow = 100
+)
+
+// phiDetector is the failure detector of a single node
+type phiDetector struct {
+	sync.Mutex
+	intervals []float64 // intervals between pings in milliseconds, a ring buffer of FailureDetectorWindow entries
+	next      int       // position of the next interval in intervals
+	last      time.Time // arrival time of the last ping
+	minStdDev float64   // lower bound of the standard deviation, so a perfectly regular node is not suspected on the first delay
+	pause     float64   // acceptable pause in milliseconds, added to the mean interval
+}
+
+// newPhiDetector creates a detector expecting pings every interval, accepting pauses of up to pause, starting now
+func newPhiDetector(interval, pause time.Duration) *phiDetector {
+	mean := float64(interval) / float64(time.Millisecond)
+	d := &phiDetector{
+		last:      time.Now(),
+		minStdDev: mean / 10,
+		pause:     float64(pause) / float64(time.Millisecond),
+	}
+
+	// bootstrap with the expected interval, until real pings replace it
+	d.add(mean - mean/4)
+	d.add(mean + mean/4)
+	return d
+}
+
+func (d *phiDetector) add(interval float64) {
+	if len(d.intervals) < FailureDetectorWindow {
+		d.intervals = append(d.intervals, interval)
+		return
+	}
+
+	d.intervals[d.next] = interval
+	d.next = (d.next + 1) % len(d.intervals)
+}
+
+// heartbeat records the arrival of a ping
+func (d *phiDetector) heartbeat(now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+	d.add(float64(now.Sub(d.last)) / float64(time.Millisecond))
+	d.last = now
+}
+
+// lastHeartbeat returns the arrival time of the last ping
+func (d *phiDetector) lastHeartbeat() time.Time {
+	d.Lock()
+	defer d.Unlock()
+	return d.last
+}
+
+// phi returns the suspicion level of the node at time now
+func (d *phiDetector) phi(now time.Time) float64 {
+	d.Lock()
+	defer d.Unlock()
+	var sum, squares float64
+	for _, interval := range d.intervals {
+		sum += interval
+		squares += interval * interval
+	}
+
+	n := float64(len(d.intervals))
+	mean := sum / n
+	stdDev := math.Sqrt(math.Max(squares/n-mean*mean, 0))
+	if stdDev < d.minStdDev {
+		stdDev = d.minStdDev
+	}
+	mean += d.pause
+
+	// logistic approximation of the cumulative normal distribution
+	elapsed := float64(now.Sub(d.last)) / float64(time.Millisecond)
+	y := (elapsed - mean) / stdDev
+	x := y * (1.5976 + 0.070566*y*y)
+	if elapsed > mean {
+		// -log10(e/(1+e)) with e = exp(-x), written so it does not overflow for large x
+		return x/math.Ln10 + math.Log10(1+math.Exp(-x))
+	}
+	return -math.Log10(1 - 1/(1+math.Exp(-x)))
+}
+
+// detectFailures periodically checks the phi of all connected nodes
+func (m *Manager) detectFailures() {
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-time.After(m.getDuration("pinginterval") / 10):
+		}
+
+		suspicion, failure := m.failureThresholds()
+		if suspicion <= 0 && failure <= 0 {
+			continue // disabled, nodes are only disconnected after the read timeout
+		}
+
+		now := time.Now()
+		for _, node := range m.connectedNodes.getAllNodes() {
+			if node.detector == nil {
+				continue // not joined yet
+			}
+
+			phi := node.detector.phi(now)
+			switch {
+			case failure > 0 && phi >= failure:
+				m.log("%s %s failed, no ping received for %v (phi:%.1f)", m.name, node.name, now.Sub(node.detector.lastHeartbeat()), phi)
+				node.close()
+
+			case suspicion > 0 && phi >= suspicion:
+				if m.connectedNodes.setSuspect(node.name, true) {
+					m.log("%s %s is suspected to have failed (phi:%.1f)", m.name, node.name, phi)
+				}
+
+			default:
+				if m.connectedNodes.setSuspect(node.name, false) {
+					m.log("%s %s is no longer suspected to have failed (phi:%.1f)", m.name, node.name, phi)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPhiDetector(t *testing.T) {
+	detector := newPhiDetector(100*time.Millisecond, 0)
+	start := detector.lastHeartbeat()
+	for i := 1; i <= 20; i++ {
+		detector.heartbeat(start.Add(time.Duration(i) * 100 * time.Millisecond))
+	}
+	last := detector.lastHeartbeat()
+
+	if phi := detector.phi(last.Add(100 * time.Millisecond)); phi > 1 {
+		t.Errorf("expected low phi when the next ping is due, but got:%f", phi)
+	}
+
+	previous := 0.0
+	for _, elapsed := range []time.Duration{150, 200, 300, 1000, 60000} {
+		phi := detector.phi(last.Add(elapsed * time.Millisecond))
+		if phi <= previous {
+			t.Errorf("expected phi to increase after %dms, but got:%f (previous:%f)", elapsed, phi, previous)
+		}
+		previous = phi
+	}
+
+	if phi := detector.phi(last.Add(300 * time.Millisecond)); phi < 16 {
+		t.Errorf("expected high phi after missing 2 pings, but got:%f", phi)
+	}
+}
+
+func TestSuspectBeforeFailure(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+	settings.PingInterval = 200 * time.Millisecond
+	settings.AcceptablePause = 0
+	settings.ReadTimeout = time.Minute
+
+	managerA := NewManager("managerSuspectA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerSuspectB", "suspectB")
+	if err := managerA.ListenAndServeTransport("suspectA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerSuspectB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerSuspectA", "suspectA")
+	if err := managerB.ListenAndServeTransport("suspectB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected managerSuspectB to join")
+	}
+
+	// let the detector learn the intervals, then managerSuspectB stops sending pings
+	time.Sleep(time.Second)
+	settings.PingInterval = time.Hour
+	managerB.UpdateSettings(settings)
+
+	suspected := false
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line := <-managerA.Log:
+			if strings.Contains(line, "managerSuspectB is suspected to have failed") {
+				suspected = true
+			}
+			if !strings.Contains(line, "managerSuspectB failed, no ping received") {
+				continue
+			}
+			if !suspected {
+				t.Errorf("expected managerSuspectB to be suspect before it was disconnected")
+			}
+			return
+
+		case <-timeout:
+			t.Fatalf("expected managerSuspectB to be disconnected by the failure detector, but got timeout (suspected:%t)", suspected)
+		}
+	}
+}
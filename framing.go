@@ -0,0 +1,258 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Packets are sent either in the JSON newline format, where each packet is a
+// JSON document on a single line, or in length prefixed binary frames:
+//
+//  [4 byte header length][4 byte message length][header][message]
+//
+// The header is the Packet without its message, both encoded with the codec
+// negotiated for the connection. The message is sent as is, so it does not
+// need to be escaped inside the header. The handshake always uses the JSON
+// newline format, so nodes without binary framing can still connect.
+//
+// Messages larger than the compression threshold are compressed, if the
+// remote node supports the compressor, and the compressor is named in the
+// Compression field of the header. In the JSON newline format a compressed
+// message is base64 encoded.
+
+var (
+	// MaxFrameSize is the maximum size of a received packet in a binary frame
+	MaxFrameSize = 64 * 1024 * 1024
+)
+
+// framing encodes and decodes packets on a connection, using binary frames if a codec is set
+type framing struct {
+	codec      Codec
+	compressor Compressor // compressor for messages we send, nil to not compress
+	threshold  int        // minimum size of messages to compress
+}
+
+// newFraming returns the framing for a negotiated codec, an empty codec uses the JSON newline format
+func newFraming(codec string) (framing, error) {
+	if codec == "" {
+		return framing{}, nil
+	}
+
+	c, ok := getCodec(codec)
+	if !ok {
+		return framing{}, fmt.Errorf("unknown codec: %s", codec)
+	}
+
+	return framing{codec: c}, nil
+}
+
+// name returns the name of the codec used by the framing
+func (f framing) name() string {
+	if f.codec == nil {
+		return ""
+	}
+
+	return f.codec.Name()
+}
+
+// framingKey identifies framings that encode a packet to the same bytes
+type framingKey struct {
+	codec      string
+	compressor string
+	threshold  int
+}
+
+func (f framing) key() framingKey {
+	k := framingKey{codec: f.name()}
+	if f.compressor != nil {
+		k.compressor, k.threshold = f.compressor.Name(), f.threshold
+	}
+
+	return k
+}
+
+// encodedPacket encodes a packet once per framing, so a packet sent to many nodes is only encoded and compressed once
+type encodedPacket struct {
+	sync.Mutex
+	packet *Packet
+	frames map[framingKey][]byte
+}
+
+func newEncodedPacket(packet *Packet) *encodedPacket {
+	return &encodedPacket{
+		packet: packet,
+		frames: make(map[framingKey][]byte),
+	}
+}
+
+// encode returns the packet encoded with framing, reusing an earlier encoding of the same framing
+func (e *encodedPacket) encode(f framing) ([]byte, error) {
+	e.Lock()
+	defer e.Unlock()
+	key := f.key()
+	if data, ok := e.frames[key]; ok {
+		return data, nil
+	}
+
+	data, err := f.encode(e.packet)
+	if err != nil {
+		return nil, err
+	}
+
+	e.frames[key] = data
+	return data, nil
+}
+
+// message returns the message of packet encoded with codec
+func (f framing) message(packet *Packet, codec string) ([]byte, error) {
+	if packet.codec == codec || (packet.codec == "" && codec == "json") {
+		return []byte(packet.DataMessage), nil
+	}
+
+	if codec == "json" {
+		return json.Marshal(packet.message)
+	}
+
+	return f.codec.Marshal(packet.message)
+}
+
+// compress compresses message if it exceeds the threshold, and returns the name of the compressor used
+func (f framing) compress(message []byte) ([]byte, string, error) {
+	if f.compressor == nil || len(message) < f.threshold {
+		return message, "", nil
+	}
+
+	compressed, err := f.compressor.Compress(message)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return compressed, f.compressor.Name(), nil
+}
+
+// decompress replaces the message of a compressed packet with its decompressed message
+func (f framing) decompress(packet *Packet) error {
+	if packet.Compression == "" {
+		return nil
+	}
+
+	compressor, ok := getCompressor(packet.Compression)
+	if !ok {
+		return fmt.Errorf("unknown compressor: %s", packet.Compression)
+	}
+
+	message := []byte(packet.DataMessage)
+	if f.codec == nil {
+		decoded, err := base64.StdEncoding.DecodeString(packet.DataMessage)
+		if err != nil {
+			return err
+		}
+		message = decoded
+	}
+
+	message, err := compressor.Decompress(message)
+	if err != nil {
+		return fmt.Errorf("Failed to decompress message:%v", err)
+	}
+
+	packet.DataMessage = string(message)
+	packet.Compression = ""
+	return nil
+}
+
+func (f framing) encode(packet *Packet) ([]byte, error) {
+	if f.codec == nil {
+		message, err := f.message(packet, "json")
+		if err != nil {
+			return nil, err
+		}
+
+		header := *packet
+		message, header.Compression, err = f.compress(message)
+		if err != nil {
+			return nil, err
+		}
+
+		header.DataMessage = string(message)
+		if header.Compression != "" {
+			header.DataMessage = base64.StdEncoding.EncodeToString(message)
+		}
+		data, err := json.Marshal(header)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(data, 10), nil // 10 = newline
+	}
+
+	message, err := f.message(packet, f.codec.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	header := *packet
+	message, header.Compression, err = f.compress(message)
+	if err != nil {
+		return nil, err
+	}
+
+	header.DataMessage = ""
+	headerData, err := f.codec.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 8, 8+len(headerData)+len(message))
+	binary.BigEndian.PutUint32(frame[0:4], uint32(len(headerData)))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(message)))
+	frame = append(frame, headerData...)
+	frame = append(frame, message...)
+	return frame, nil
+}
+
+func (f framing) decode(reader *bufio.Reader) (*Packet, error) {
+	if f.codec == nil {
+		bytes, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		packet, err := UnpackPacket(bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		return packet, f.decompress(packet)
+	}
+
+	var lengths [8]byte
+	if _, err := io.ReadFull(reader, lengths[:]); err != nil {
+		return nil, err
+	}
+
+	headerLength := binary.BigEndian.Uint32(lengths[0:4])
+	messageLength := binary.BigEndian.Uint32(lengths[4:8])
+	if uint64(headerLength)+uint64(messageLength) > uint64(MaxFrameSize) {
+		return nil, fmt.Errorf("frame of %d bytes exceeds the maximum of %d bytes", uint64(headerLength)+uint64(messageLength), MaxFrameSize)
+	}
+
+	data := make([]byte, headerLength+messageLength)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	packet := &Packet{}
+	err := f.codec.Unmarshal(data[:headerLength], packet)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode packet header:%v", err)
+	}
+
+	packet.DataMessage = string(data[headerLength:])
+	packet.codec = f.codec.Name()
+	return packet, f.decompress(packet)
+}
@@ -0,0 +1,307 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type framedMessage struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+func TestFramingRoundTrip(t *testing.T) {
+	manager := NewManager("managerFraming", "secret")
+	for _, codec := range []string{"", "json", "gob", "msgpack", "protobuf"} {
+		framing, err := newFraming(codec)
+		if err != nil {
+			t.Fatalf("expected framing for codec %q, but got:%s", codec, err)
+		}
+
+		var stream bytes.Buffer
+		for i := 0; i < 3; i++ {
+			packet := manager.packetFor(framedMessage{Value: "line\nbreak \"quoted\"", Count: i})
+			packet.Sequence = uint64(i + 1)
+			data, err := framing.encode(packet)
+			if err != nil {
+				t.Fatalf("expected %q to encode, but got:%s", codec, err)
+			}
+			stream.Write(data)
+		}
+
+		reader := bufio.NewReader(&stream)
+		for i := 0; i < 3; i++ {
+			packet, err := framing.decode(reader)
+			if err != nil {
+				t.Fatalf("expected %q to decode packet %d, but got:%s", codec, i, err)
+			}
+
+			message := &framedMessage{}
+			err = packet.Message(message)
+			if err != nil || message.Value != "line\nbreak \"quoted\"" || message.Count != i {
+				t.Errorf("expected %q to decode message %d, but got:%+v %v", codec, i, message, err)
+			}
+
+			if packet.Name != "managerFraming" || packet.DataType != "cluster.framedMessage" || packet.Sequence != uint64(i+1) {
+				t.Errorf("expected %q to decode the packet header, but got:%+v", codec, packet)
+			}
+		}
+	}
+
+	// gob can not encode structs without exported fields, they are sent empty
+	framing, _ := newFraming("gob")
+	data, err := framing.encode(manager.packetFor(&packetNodeShutdown{}))
+	if err != nil {
+		t.Errorf("expected empty message to encode with gob, but got:%s", err)
+	}
+
+	packet, err := framing.decode(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil || packet.DataType != "cluster.packetNodeShutdown" {
+		t.Errorf("expected empty message to decode with gob, but got:%+v %v", packet, err)
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	manager := NewManager("managerProtobuf", "secret")
+	framing, _ := newFraming("protobuf")
+
+	// messages implementing proto.Message are encoded with protobuf
+	packet := manager.packetFor(wrapperspb.String("proto"))
+	packet.RequestID, packet.Response, packet.Error, packet.Topic = "request", true, "failed", "jobs"
+	data, err := framing.encode(packet)
+	if err != nil {
+		t.Fatalf("expected protobuf message to encode, but got:%s", err)
+	}
+
+	decoded, err := framing.decode(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("expected protobuf message to decode, but got:%s", err)
+	}
+
+	if message, _ := proto.Marshal(wrapperspb.String("proto")); decoded.DataMessage != string(message) {
+		t.Errorf("expected the message to be encoded with protobuf, but got:%q", decoded.DataMessage)
+	}
+
+	message := &wrapperspb.StringValue{}
+	if err := decoded.Message(message); err != nil || message.Value != "proto" {
+		t.Errorf("expected protobuf message proto, but got:%v %v", message, err)
+	}
+
+	if decoded.Name != packet.Name || decoded.RequestID != "request" || !decoded.Response || decoded.Error != "failed" ||
+		decoded.Topic != "jobs" || !decoded.Time.Equal(packet.Time) {
+		t.Errorf("expected protobuf to decode the packet header, but got:%+v", decoded)
+	}
+}
+
+func TestFramingMaxFrameSize(t *testing.T) {
+	framing, _ := newFraming("json")
+	frame := make([]byte, 8)
+	binary.BigEndian.PutUint32(frame[0:4], 16)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(MaxFrameSize))
+	if _, err := framing.decode(bufio.NewReader(bytes.NewReader(frame))); err == nil {
+		t.Errorf("expected frame exceeding MaxFrameSize to be rejected")
+	}
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	codecs := []string{"gob", "", "json", "msgpack", "protobuf"}
+	var managers []*Manager
+	for i, codec := range codecs {
+		settings := defaultSetting()
+		settings.ConnectInterval = 100 * time.Millisecond
+		settings.JoinDelay = 10 * time.Millisecond
+		settings.Codec = codec
+
+		manager := NewManager(fmt.Sprintf("managerCodec%d", i), "secret")
+		manager.UpdateSettings(settings)
+		for j := range codecs {
+			if j != i {
+				manager.AddNode(fmt.Sprintf("managerCodec%d", j), fmt.Sprintf("codec%d", j))
+			}
+		}
+
+		err := manager.ListenAndServeTransport(fmt.Sprintf("codec%d", i), network)
+		if err != nil {
+			t.Fatalf("expected listen on memory network to work, but got:%s", err)
+		}
+		defer manager.Shutdown(context.Background())
+		managers = append(managers, manager)
+	}
+
+	connected := func() bool {
+		for _, manager := range managers {
+			if len(manager.connectedNodes.nodeNames()) != len(managers)-1 {
+				return false
+			}
+		}
+		return true
+	}
+	if !waitFor(5*time.Second, connected) {
+		t.Fatalf("expected all nodes to connect")
+	}
+
+	// a node without a codec uses the JSON newline format with everyone
+	for _, node := range managers[1].connectedNodes.getAllNodes() {
+		if node.framing.name() != "" {
+			t.Errorf("expected JSON newline format between managerCodec1 and %s, but got:%s", node.name, node.framing.name())
+		}
+	}
+
+	managers[0].ToCluster <- framedMessage{Value: "hello", Count: 1}
+	for _, manager := range managers[1:] {
+		packet, timeout := channelReadPacket(manager.FromCluster, 2)
+		if timeout {
+			t.Fatalf("expected message on %s, but got timeout", manager.name)
+		}
+
+		message := &framedMessage{}
+		if err := packet.Message(message); err != nil || message.Value != "hello" {
+			t.Errorf("expected message hello on %s, but got:%+v %v", manager.name, message, err)
+		}
+	}
+}
+
+func TestFramingCompression(t *testing.T) {
+	manager := NewManager("managerCompression", "secret")
+	value := strings.Repeat("compressible ", 1000)
+	for _, compressor := range []Compressor{GzipCompressor{}, ZstdCompressor{}, SnappyCompressor{}} {
+		for _, codec := range []string{"", "json", "gob", "msgpack", "protobuf"} {
+			framing, _ := newFraming(codec)
+			framing.compressor, framing.threshold = compressor, 1024
+
+			small, _ := framing.encode(manager.packetFor(framedMessage{Value: "small"}))
+			large, err := framing.encode(manager.packetFor(framedMessage{Value: value}))
+			if err != nil {
+				t.Fatalf("expected %q to encode a message compressed with %s, but got:%s", codec, compressor.Name(), err)
+			}
+
+			if len(large) > len(value)/10 {
+				t.Errorf("expected %q to compress the large message with %s, but got %d bytes", codec, compressor.Name(), len(large))
+			}
+
+			reader := bufio.NewReader(bytes.NewReader(append(small, large...)))
+			for _, expected := range []string{"small", value} {
+				packet, err := framing.decode(reader)
+				if err != nil {
+					t.Fatalf("expected %q to decode, but got:%s", codec, err)
+				}
+
+				message := &framedMessage{}
+				if err := packet.Message(message); err != nil || message.Value != expected || packet.Compression != "" {
+					t.Errorf("expected %q to decompress the %s message transparently, but got:%d bytes %v", codec, compressor.Name(), len(message.Value), err)
+				}
+			}
+		}
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+	settings.CompressionSize = 1024
+
+	managerA := NewManager("managerCompressA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerCompressB", "compressB")
+	if err := managerA.ListenAndServeTransport("compressA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerCompressB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerCompressA", "compressA")
+	if err := managerB.ListenAndServeTransport("compressB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if _, timeout := channelReadString(managerB.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on managerCompressB, but got timeout")
+	}
+
+	for _, node := range managerA.connectedNodes.getAllNodes() {
+		if node.framing.compressor == nil || node.framing.compressor.Name() != "gzip" {
+			t.Errorf("expected gzip compression to managerCompressB, but got:%v", node.framing.compressor)
+		}
+	}
+
+	value := strings.Repeat("compressible ", 1000)
+	managerA.ToCluster <- framedMessage{Value: value}
+	packet, timeout := channelReadPacket(managerB.FromCluster, 2)
+	if timeout {
+		t.Fatalf("expected message on managerCompressB, but got timeout")
+	}
+
+	message := &framedMessage{}
+	if err := packet.Message(message); err != nil || message.Value != value {
+		t.Errorf("expected the large message on managerCompressB, but got:%d bytes %v", len(message.Value), err)
+	}
+}
+
+// countingCompressor counts how often it compressed a message
+type countingCompressor struct {
+	GzipCompressor
+	count *int32
+}
+
+func (countingCompressor) Name() string { return "counting" }
+
+func (c countingCompressor) Compress(data []byte) ([]byte, error) {
+	atomic.AddInt32(c.count, 1)
+	return c.GzipCompressor.Compress(data)
+}
+
+func TestEncodedPacket(t *testing.T) {
+	manager := NewManager("managerEncoded", "secret")
+	var count int32
+	compressor := countingCompressor{count: &count}
+	RegisterCompressor(compressor)
+
+	encoded := newEncodedPacket(manager.packetFor(framedMessage{Value: strings.Repeat("compressible ", 1000)}))
+	framings := make([]framing, 0)
+	for _, codec := range []string{"json", "json", "gob"} {
+		framing, _ := newFraming(codec)
+		framing.compressor, framing.threshold = compressor, 1024
+		framings = append(framings, framing)
+	}
+
+	var frames [][]byte
+	for _, framing := range framings {
+		data, err := encoded.encode(framing)
+		if err != nil {
+			t.Fatalf("expected %s to encode, but got:%s", framing.name(), err)
+		}
+		frames = append(frames, data)
+	}
+
+	if count != 2 {
+		t.Errorf("expected the packet to be compressed once per framing, but got:%d", count)
+	}
+
+	if !bytes.Equal(frames[0], frames[1]) {
+		t.Errorf("expected nodes with the same framing to share the encoded packet")
+	}
+
+	packet, err := framings[2].decode(bufio.NewReader(bytes.NewReader(frames[2])))
+	if err != nil || packet.DataType != "cluster.framedMessage" {
+		t.Errorf("expected the gob frame to decode, but got:%v %v", packet, err)
+	}
+}
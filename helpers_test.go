@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// waitFor polls condition until it is true, or returns false after timeout
+func waitFor(timeout time.Duration, condition func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return condition()
+}
+
+// startMemoryCluster starts n managers named prefix0..prefixN on a memory network, each configured with all others
+// The managers are shut down when the test finishes, configure can change their settings before they start
+func startMemoryCluster(t *testing.T, prefix string, n int, configure ...func(*Settings)) []*Manager {
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+	for _, f := range configure {
+		f(&settings)
+	}
+
+	var managers []*Manager
+	for i := 0; i < n; i++ {
+		manager := NewManager(fmt.Sprintf("%s%d", prefix, i), "secret")
+		manager.UpdateSettings(settings)
+		for j := 0; j < n; j++ {
+			if j != i {
+				manager.AddNode(fmt.Sprintf("%s%d", prefix, j), fmt.Sprintf("%s%d", prefix, j))
+			}
+		}
+
+		if err := manager.ListenAndServeTransport(manager.name, network); err != nil {
+			t.Fatalf("expected listen on memory network to work, but got:%s", err)
+		}
+		t.Cleanup(func() {
+			manager.Shutdown(context.Background())
+		})
+		managers = append(managers, manager)
+	}
+
+	return managers
+}
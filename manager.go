@@ -27,68 +27,124 @@ type NodeMessage struct {
 
 // Manager is the main cluster manager
 type Manager struct {
-	sync.RWMutex
-	name             string               // name of our cluster node
-	authKey          string               // authentication key
-	settings         Settings             // adjustable settings
-	listener         net.Listener         // our listener
-	connectedNodes   *connectionPool      // the list of connected nodes and their sockets
-	configuredNodes  map[string]Node      // details of the remote cluster nodes
-	newSocket        chan net.Conn        // new clients connecting
-	internalMessage  chan internalMessage // internally sent messages within the cluster
-	apiRequest       chan APIRequest      // API sent messages to the cluster from the API
-	incommingPackets chan Packet          // packets sent to packet manager
-	quit             chan bool            // signals exit of listener
-	FromCluster      chan Packet          // data received from cluster
-	FromClusterAPI   chan APIRequest      // data received from cluster via API interface
-	ToCluster        chan interface{}     // data send to cluster
-	ToNode           chan NodeMessage     // data send to specific node
-	Log              chan string          // logging messages go here
-	NodeJoin         chan string          // returns string of the node joining
-	NodeLeave        chan string          // returns string of the node leaving
-	QuorumState      chan bool            // returns the current quorum state
-	useTLS           bool                 // wether or not to use tls
+	mu                sync.RWMutex           // protects the manager state
+	name              string                 // name of our cluster node
+	authKey           string                 // authentication key
+	settings          Settings               // adjustable settings
+	listener          net.Listener           // our listener
+	connectedNodes    *connectionPool        // the list of connected nodes and their sockets
+	configuredNodes   map[string]Node        // details of the remote cluster nodes
+	newSocket         chan net.Conn          // new clients connecting
+	internalMessage   chan internalMessage   // internally sent messages within the cluster
+	apiRequest        chan APIRequest        // API sent messages to the cluster from the API
+	incommingPackets  chan Packet            // packets sent to packet manager
+	quit              chan bool              // signals exit of listener
+	packetsDone       chan struct{}          // closed when the packet manager exited
+	FromCluster       chan Packet            // data received from cluster
+	FromClusterAPI    chan APIRequest        // data received from cluster via API interface
+	ToCluster         chan interface{}       // data send to cluster
+	ToClusterReliable chan interface{}       // data send to cluster, retransmitted until acknowledged by each node
+	ToNode            chan NodeMessage       // data send to specific node
+	Log               chan string            // logging messages go here
+	NodeJoin          chan string            // returns string of the node joining
+	NodeLeave         chan string            // returns string of the node leaving
+	NodeDrain         chan string            // returns string of the node draining before it leaves
+	QuorumState       chan bool              // returns the current quorum state
+	LeaderChange      chan string            // returns the name of the new leader, or empty if there is none
+	Streams           chan *Stream           // returns streams sent to us with SendStream
+	ClockSkew         chan ClockSkewEvent    // returns nodes with a clock offset exceeding the maximum clock skew
+	UnknownType       chan UnknownTypeEvent  // returns messages received of types not registered with RegisterType
+	leader            string                 // name of the current cluster leader
+	calls             *callPool              // requests waiting for a response
+	callHandlers      map[string]CallHandler // handlers for requests per data type
+	handlers          *handlerPool           // handlers registered with Handle
+	reliable          *reliableQueue         // reliable packets waiting to be acknowledged
+	deliveries        *deliveryPool          // reliable packets waiting to be delivered to the client application
+	kv                *kvStore               // replicated key/value store
+	locks             *lockTable             // locks granted while we are the leader
+	topics            *topicPool             // subscriptions to published topics
+	streams           *streamPool            // streams being sent and received
+	liveness          *liveness              // cluster wide view of the nodes reported to the client application
+	dialers           *dialerPool            // connection state of the configured nodes
+	addr              string                 // address we are listening on
+	transport         Transport              // transport used to listen and connect to other nodes
+	members           map[string]member      // membership of the cluster shared using gossip
+	minVersion        int                    // oldest protocol version of other nodes we accept
+	state             int                    // lifecycle state of the manager
+	draining          bool                   // wether we are draining before we leave the cluster
+	running           bool                   // wether Run is waiting for the manager to stop
+	wg                sync.WaitGroup         // goroutines Shutdown waits for
+	useTLS            bool                   // wether or not to use tls
 }
 
 var managers = struct {
 	sync.RWMutex
 	manager       []string
+	active        map[string]*Manager // running manager per name, used by the API
+	api           map[string]bool     // names the API handlers are registered for
 	clusterAPISet bool
-}{}
+}{
+	active: make(map[string]*Manager),
+	api:    make(map[string]bool),
+}
 
 // NewManager creates a new cluster manager
 func NewManager(name, authKey string) *Manager {
 	m := &Manager{
-		name:             name,
-		authKey:          authKey,
-		settings:         defaultSetting(),
-		configuredNodes:  make(map[string]Node),
-		connectedNodes:   newConnectionPool(),
-		newSocket:        make(chan net.Conn),
-		internalMessage:  make(chan internalMessage, 100),
-		apiRequest:       make(chan APIRequest, 100),
-		incommingPackets: make(chan Packet, 100),
-		quit:             make(chan bool),
-		FromCluster:      make(chan Packet, ChannelBufferSize),
-		FromClusterAPI:   make(chan APIRequest, ChannelBufferSize),
-		ToCluster:        make(chan interface{}, ChannelBufferSize),
-		ToNode:           make(chan NodeMessage, 100),
-		Log:              make(chan string, ChannelBufferSize),
-		NodeJoin:         make(chan string, 10),
-		NodeLeave:        make(chan string, 10),
-		QuorumState:      make(chan bool, 10),
+		name:              name,
+		authKey:           authKey,
+		settings:          defaultSetting(),
+		configuredNodes:   make(map[string]Node),
+		connectedNodes:    newConnectionPool(),
+		calls:             newCallPool(),
+		callHandlers:      make(map[string]CallHandler),
+		handlers:          newHandlerPool(HandlerWorkers),
+		reliable:          newReliableQueue(),
+		deliveries:        newDeliveryPool(),
+		kv:                newKVStore(name),
+		locks:             newLockTable(),
+		topics:            newTopicPool(),
+		streams:           newStreamPool(),
+		liveness:          newLiveness(),
+		dialers:           newDialerPool(),
+		members:           make(map[string]member),
+		minVersion:        MinProtocolVersion,
+		newSocket:         make(chan net.Conn),
+		internalMessage:   make(chan internalMessage, 100),
+		apiRequest:        make(chan APIRequest, 100),
+		incommingPackets:  make(chan Packet, 100),
+		quit:              make(chan bool),
+		packetsDone:       make(chan struct{}),
+		FromCluster:       make(chan Packet, ChannelBufferSize),
+		FromClusterAPI:    make(chan APIRequest, ChannelBufferSize),
+		ToCluster:         make(chan interface{}, ChannelBufferSize),
+		ToClusterReliable: make(chan interface{}, ChannelBufferSize),
+		ToNode:            make(chan NodeMessage, 100),
+		Log:               make(chan string, ChannelBufferSize),
+		NodeJoin:          make(chan string, 10),
+		NodeLeave:         make(chan string, 10),
+		NodeDrain:         make(chan string, 10),
+		QuorumState:       make(chan bool, 10),
+		LeaderChange:      make(chan string, 10),
+		Streams:           make(chan *Stream, 10),
+		ClockSkew:         make(chan ClockSkewEvent, 10),
+		UnknownType:       make(chan UnknownTypeEvent, 10),
 	}
-	addManager(m.name)
+	m.callHandlers["cluster.packetLockRequest"] = m.handleLockRequest
+	m.callHandlers["cluster.packetProbeRequest"] = m.handleProbeRequest
+	m.callHandlers["cluster.packetProbe"] = m.handleProbe
+	addManager(m)
 	if APIEnabled {
 		m.addClusterAPI()
 	}
 	return m
 }
 
-func addManager(name string) {
+func addManager(m *Manager) {
 	managers.Lock()
 	defer managers.Unlock()
-	managers.manager = append(managers.manager, name)
+	managers.manager = append(managers.manager, m.name)
+	managers.active[m.name] = m
 }
 
 func removeManager(name string) {
@@ -101,14 +157,26 @@ func removeManager(name string) {
 		}
 	}
 	managers.manager = new
+	delete(managers.active, name)
+}
+
+// getManager returns the manager with name, or nil if there is none
+func getManager(name string) *Manager {
+	managers.RLock()
+	defer managers.RUnlock()
+	return managers.active[name]
 }
 
 func (m *Manager) addClusterAPI() {
 	managers.Lock()
 	defer managers.Unlock()
 
-	http.Handle("/api/v1/cluster/"+m.name+"/admin/", authenticate(apiClusterAdminHandler{manager: m}, m.authKey))
-	http.Handle("/api/v1/cluster/"+m.name, apiClusterPublicHandler{manager: m})
+	// handlers look up the manager by name, so a new manager with the same name can replace a stopped one
+	if !managers.api[m.name] {
+		http.Handle("/api/v1/cluster/"+m.name+"/admin/", authenticate(apiClusterAdminHandler{name: m.name}, m.name))
+		http.Handle("/api/v1/cluster/"+m.name, apiClusterPublicHandler{name: m.name})
+		managers.api[m.name] = true
+	}
 	if managers.clusterAPISet == false {
 		http.Handle("/api/v1/cluster", apiClusterHandler{})
 		managers.clusterAPISet = true
@@ -118,55 +186,66 @@ func (m *Manager) addClusterAPI() {
 // ListenAndServeTLS starts the TLS listener and serves connections to clients
 func (m *Manager) ListenAndServeTLS(addr string, tlsConfig *tls.Config) (err error) {
 	m.log("%s Starting TLS listener on %s", m.name, addr)
-	s := newServer(addr, tlsConfig)
-	m.listener, err = s.Listen()
-	if err == nil {
-		m.start(s, tlsConfig)
-	}
-	return
+	return m.ListenAndServeTransport(addr, TLSTransport{Config: tlsConfig})
 }
 
 // ListenAndServe starts the listener and serves connections to clients
 func (m *Manager) ListenAndServe(addr string) (err error) {
 	m.log("%s Starting listener on %s", m.name, addr)
-	s := newServer(addr, &tls.Config{})
+	return m.ListenAndServeTransport(addr, TCPTransport{})
+}
+
+// ListenAndServeTransport starts the listener on the given transport and serves connections to clients
+// Connections to other nodes are made using the same transport
+// It fails if the manager was started before
+func (m *Manager) ListenAndServeTransport(addr string, transport Transport) (err error) {
+	if err = m.setStarted(); err != nil {
+		return
+	}
+
+	m.addr = addr
+	m.transport = transport
+	s := newServer(addr, transport)
 	m.listener, err = s.Listen()
-	if err == nil {
-		m.start(s, &tls.Config{})
+	if err != nil {
+		m.mu.Lock()
+		m.state = stateNew
+		m.mu.Unlock()
+		return
 	}
+
+	m.start(s)
 	return
 }
 
-func (m *Manager) start(s *server, tlsConfig *tls.Config) {
-	go m.handleIncommingConnections()         // handles incommin socket connections
-	go m.handleOutgoingConnections(tlsConfig) // creates connections to remote nodes
-	go m.handlePackets()                      // handles all incomming packets
-	go s.Serve(m.newSocket, m.quit)           // accepts new connections and passes them on to the manager
+func (m *Manager) start(s *server) {
+	m.spawn(m.handleIncommingConnections) // handles incommin socket connections
+	m.spawn(m.handleOutgoingConnections)  // creates connections to remote nodes
+	m.spawn(m.handlePackets)              // handles all incomming packets
+	m.spawn(m.gossip)                     // shares the cluster membership with other nodes
+	m.spawn(m.detectFailures)             // disconnects nodes that stopped sending pings
+	m.spawn(func() {
+		s.Serve(m.newSocket, m.quit) // accepts new connections and passes them on to the manager
+	})
+	for _, worker := range m.handlers.workers {
+		worker := worker
+		m.spawn(func() {
+			m.handlerWorker(worker) // runs handlers registered with Handle
+		})
+	}
 	m.log("%s Cluster quorum state: %t", m.name, m.quorum())
 	select {
 	case m.QuorumState <- m.quorum(): // quorum update to client application
 	default:
 	}
+	m.electLeader()
 	return
 }
 
-// Shutdown stops the cluster node
-func (m *Manager) Shutdown() {
-	m.log("%s Stopping listener on %s", m.name, m.listener.Addr())
-	// write exit message to remote cluster
-	packet, _ := m.newPacket(&packetNodeShutdown{})
-	m.connectedNodes.writeAll(packet)
-	// close all connected nodes
-	m.connectedNodes.closeAll()
-	close(m.quit)
-	m.listener.Close()
-	removeManager(m.name)
-}
-
 // quorum returns quorum state based on configured vs connected nodes
 func (m *Manager) quorum() bool {
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	switch len(m.configuredNodes) {
 	case 0:
 		return true // single node
@@ -185,26 +264,43 @@ func (m *Manager) updateQuorum() {
 	}
 }
 
-// AddNode adds a cluster node to the cluster to be connected to
+// AddNode adds a cluster node to the cluster to be connected to, the node is added on all nodes of the cluster
 func (m *Manager) AddNode(nodeName, nodeAddr string) {
-	m.Lock()
-	defer m.Unlock()
-	m.configuredNodes[nodeName] = Node{
-		name:      nodeName,
-		addr:      nodeAddr,
-		statusStr: StatusOffline,
+	m.addNode(nodeName, nodeAddr)
+	m.updateMember(nodeName, nodeAddr, false)
+}
+
+// addNode configures a node, or updates the address of a configured node keeping its status
+func (m *Manager) addNode(nodeName, nodeAddr string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node, ok := m.configuredNodes[nodeName]
+	if !ok {
+		node = Node{name: nodeName, statusStr: StatusOffline}
 	}
+	node.addr = nodeAddr
+	m.configuredNodes[nodeName] = node
 	select {
 	case m.internalMessage <- internalMessage{Type: "nodeadd", Node: nodeName}:
 	default:
 	}
 }
 
+// setNodeError records why we are unable to communicate with a configured node, an empty err clears it
+func (m *Manager) setNodeError(nodeName, err string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if node, ok := m.configuredNodes[nodeName]; ok {
+		node.errorStr = err
+		m.configuredNodes[nodeName] = node
+	}
+}
+
 // NodesConfigured returns all nodes configured to be part of the cluster
 func (m *Manager) NodesConfigured() map[string]bool {
 	node := make(map[string]bool)
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for name := range m.configuredNodes {
 		node[name] = true
 	}
@@ -214,8 +310,8 @@ func (m *Manager) NodesConfigured() map[string]bool {
 
 // NodeConfigured returns true or false if a node is configured in the manager
 func (m *Manager) NodeConfigured(nodeName string) bool {
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	if _, ok := m.configuredNodes[nodeName]; ok {
 		return true
 	}
@@ -224,9 +320,15 @@ func (m *Manager) NodeConfigured(nodeName string) bool {
 }
 
 // RemoveNode remove a cluster node from the list of servers to connect to, and close its connections
+// The node is removed on all nodes of the cluster
 func (m *Manager) RemoveNode(nodeName string) {
-	m.Lock()
-	defer m.Unlock()
+	m.removeNode(nodeName)
+	m.updateMember(nodeName, "", true)
+}
+
+func (m *Manager) removeNode(nodeName string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.log("%s is removing node %s", m.name, nodeName)
 	if _, ok := m.configuredNodes[nodeName]; ok {
 		delete(m.configuredNodes, nodeName)
@@ -238,11 +340,20 @@ func (m *Manager) RemoveNode(nodeName string) {
 	}
 
 	m.connectedNodes.close(nodeName)
+	m.dialers.remove(nodeName)
+}
+
+// configuredAddr returns the address of a configured node, and false if the node is not configured
+func (m *Manager) configuredAddr(nodeName string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, ok := m.configuredNodes[nodeName]
+	return node.addr, ok
 }
 
 func (m *Manager) getConfiguredNodes() (nodes []Node) {
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, node := range m.configuredNodes {
 		nodes = append(nodes, node)
 	}
@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"fmt"
+	"time"
+)
+
+// Reconnect closes the connection to a node, and dials it again right away
+func (m *Manager) Reconnect(node string) error {
+	if !m.NodeConfigured(node) {
+		return fmt.Errorf("unknown node %s", node)
+	}
+
+	m.log("%s Reconnecting to %s", m.name, node)
+	m.connectedNodes.close(node)
+	m.dialers.retry(node)
+	return nil
+}
+
+// AdminDown disconnects a node, and refuses connections to and from it for duration
+func (m *Manager) AdminDown(node string, duration time.Duration) error {
+	if !m.NodeConfigured(node) {
+		return fmt.Errorf("unknown node %s", node)
+	}
+
+	if duration <= 0 {
+		return fmt.Errorf("invalid duration %v, it must be positive", duration)
+	}
+
+	until := time.Now().Add(duration)
+	m.log("%s %s is administratively down until %s", m.name, node, until.Format(time.RFC3339))
+	m.dialers.setAdminDown(node, until)
+	m.connectedNodes.close(node)
+	m.setNodeError(node, "administratively down")
+	return nil
+}
+
+// AdminUp undoes AdminDown, and dials the node again right away
+func (m *Manager) AdminUp(node string) error {
+	if !m.NodeConfigured(node) {
+		return fmt.Errorf("unknown node %s", node)
+	}
+
+	m.log("%s %s is administratively up", m.name, node)
+	m.dialers.setAdminDown(node, time.Time{})
+	m.setNodeError(node, "")
+	m.dialers.retry(node)
+	return nil
+}
@@ -0,0 +1,258 @@
+package cluster
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminDown(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerAdminA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerAdminB", "adminB")
+	if err := managerA.ListenAndServeTransport("adminA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerAdminB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerAdminA", "adminA")
+	if err := managerB.ListenAndServeTransport("adminB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	connected := func() bool { return managerA.connectedNodes.nodeExists("managerAdminB") }
+	disconnected := func() bool { return !managerA.connectedNodes.nodeExists("managerAdminB") }
+	if !waitFor(5*time.Second, connected) {
+		t.Fatalf("expected managerAdminB to connect")
+	}
+
+	if err := managerA.AdminDown("managerAdminUnknown", time.Minute); err == nil {
+		t.Errorf("expected admindown of an unknown node to fail")
+	}
+
+	if err := managerA.AdminDown("managerAdminB", time.Minute); err != nil {
+		t.Fatalf("expected admindown to work, but got:%s", err)
+	}
+
+	if !waitFor(5*time.Second, disconnected) {
+		t.Fatalf("expected managerAdminB to be disconnected")
+	}
+
+	// neither side reconnects while the node is down
+	time.Sleep(500 * time.Millisecond)
+	if connected() {
+		t.Errorf("expected managerAdminB to stay disconnected while down")
+	}
+
+	if state, until := managerA.dialers.getState("managerAdminB"); state != ConnectAdminDown || until.Before(time.Now()) {
+		t.Errorf("expected managerAdminB to be %s, but got:%s (until:%v)", ConnectAdminDown, state, until)
+	}
+
+	if err := managerA.AdminUp("managerAdminB"); err != nil {
+		t.Fatalf("expected adminup to work, but got:%s", err)
+	}
+
+	if !waitFor(5*time.Second, connected) {
+		t.Fatalf("expected managerAdminB to reconnect after adminup")
+	}
+
+	// reconnect replaces the connection
+	managerA.connectedNodes.RLock()
+	joined := managerA.connectedNodes.nodes["managerAdminB"].joinTime
+	managerA.connectedNodes.RUnlock()
+	if err := managerA.Reconnect("managerAdminB"); err != nil {
+		t.Fatalf("expected reconnect to work, but got:%s", err)
+	}
+
+	reconnected := func() bool {
+		managerA.connectedNodes.RLock()
+		defer managerA.connectedNodes.RUnlock()
+		node, ok := managerA.connectedNodes.nodes["managerAdminB"]
+		return ok && node.joinTime.After(joined)
+	}
+	if !waitFor(5*time.Second, reconnected) {
+		t.Errorf("expected managerAdminB to reconnect")
+	}
+}
+
+func TestAdminNodes(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerNodesA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerNodesB", "nodesB")
+	if err := managerA.ListenAndServeTransport("nodesA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerNodesB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerNodesA", "nodesA")
+	if err := managerB.ListenAndServeTransport("nodesB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if !waitFor(5*time.Second, func() bool { return managerA.connectedNodes.nodeExists("managerNodesB") }) {
+		t.Fatalf("expected managerNodesB to connect")
+	}
+
+	admin := func(node, action, data string) int {
+		url := "/api/v1/cluster/managerNodesA/admin/" + node + "/" + action
+		w := httptest.NewRecorder()
+		apiClusterAdminHandler{name: "managerNodesA"}.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(data)))
+		return w.Code
+	}
+	addrOf := func(manager *Manager, node string) string {
+		addr, _ := manager.configuredAddr(node)
+		return addr
+	}
+
+	tests := []struct {
+		node   string
+		action string
+		data   string
+		status int
+	}{
+		{node: "managerNodesC", action: "add", data: `{"addr": "nodesC", "cluster": true}`, status: 200},
+		{node: "managerNodesC", action: "add", data: `{"addr": "nodesC"}`, status: 409},
+		{node: "managerNodesD", action: "add", data: `{}`, status: 400},
+		{node: "managerNodesA", action: "add", data: `{"addr": "nodesA"}`, status: 400},
+		{node: "managerNodesD", action: "remove", data: ``, status: 404},
+		{node: "managerNodesD", action: "update", data: `{"addr": "nodesD"}`, status: 404},
+		{node: "managerNodesC", action: "update", data: `{}`, status: 400},
+		{node: "managerNodesC", action: "add", data: `{invalid`, status: 400},
+	}
+	for _, test := range tests {
+		if status := admin(test.node, test.action, test.data); status != test.status {
+			t.Errorf("expected status %d for %s of %s with %s, but got:%d", test.status, test.action, test.node, test.data, status)
+		}
+	}
+
+	// added on all nodes of the cluster
+	if !waitFor(5*time.Second, func() bool { return addrOf(managerB, "managerNodesC") == "nodesC" }) {
+		t.Errorf("expected managerNodesC to be added on managerNodesB")
+	}
+
+	w := httptest.NewRecorder()
+	apiClusterAdminHandler{name: "managerNodesA"}.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/cluster/managerNodesA/admin/nodes", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "nodesC") {
+		t.Errorf("expected managerNodesC in the node list, but got:%d %s", w.Code, w.Body.String())
+	}
+
+	// updated on this node only
+	if status := admin("managerNodesC", "update", `{"addr": "nodesC2"}`); status != 200 {
+		t.Errorf("expected update of managerNodesC to work, but got:%d", status)
+	}
+
+	if addr := addrOf(managerA, "managerNodesC"); addr != "nodesC2" {
+		t.Errorf("expected address nodesC2 of managerNodesC, but got:%s", addr)
+	}
+
+	if addr := addrOf(managerB, "managerNodesC"); addr != "nodesC" {
+		t.Errorf("expected address of managerNodesC to stay nodesC on managerNodesB, but got:%s", addr)
+	}
+
+	// removed on all nodes of the cluster
+	if status := admin("managerNodesC", "remove", `{"cluster": true}`); status != 200 {
+		t.Errorf("expected remove of managerNodesC to work, but got:%d", status)
+	}
+
+	removed := func() bool {
+		return !managerA.NodeConfigured("managerNodesC") && !managerB.NodeConfigured("managerNodesC")
+	}
+	if !waitFor(5*time.Second, removed) {
+		t.Errorf("expected managerNodesC to be removed on all nodes")
+	}
+}
+
+func TestAdminUpdateCluster(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	var managers []*Manager
+	for _, name := range []string{"A", "B", "C"} {
+		manager := NewManager("managerUpdate"+name, "secret")
+		manager.UpdateSettings(settings)
+		for _, other := range []string{"A", "B", "C"} {
+			if other != name {
+				manager.addNode("managerUpdate"+other, "update"+other)
+			}
+		}
+		if err := manager.ListenAndServeTransport("update"+name, network); err != nil {
+			t.Fatalf("expected listen on memory network to work, but got:%s", err)
+		}
+		defer manager.Shutdown(context.Background())
+		managers = append(managers, manager)
+	}
+	managerA, managerB := managers[0], managers[1]
+
+	connected := func() bool {
+		return managerA.connectedNodes.nodeExists("managerUpdateC") && managerB.connectedNodes.nodeExists("managerUpdateC")
+	}
+	if !waitFor(5*time.Second, connected) {
+		t.Fatalf("expected managerUpdateC to connect")
+	}
+
+	// changing the address keeps the status of the node
+	managerA.setNodeError("managerUpdateC", "kept")
+	managerA.addNode("managerUpdateC", "updateC")
+	managerA.mu.RLock()
+	nodeError := managerA.configuredNodes["managerUpdateC"].errorStr
+	managerA.mu.RUnlock()
+	if nodeError != "kept" {
+		t.Errorf("expected the error of managerUpdateC to be kept, but got:%q", nodeError)
+	}
+
+	managerB.connectedNodes.RLock()
+	joined := managerB.connectedNodes.nodes["managerUpdateC"].joinTime
+	managerB.connectedNodes.RUnlock()
+
+	url := "/api/v1/cluster/managerUpdateA/admin/managerUpdateC/update"
+	w := httptest.NewRecorder()
+	apiClusterAdminHandler{name: "managerUpdateA"}.ServeHTTP(w, httptest.NewRequest("POST", url, strings.NewReader(`{"addr": "updateC2", "cluster": true}`)))
+	if w.Code != 200 {
+		t.Fatalf("expected update of managerUpdateC to work, but got:%d %s", w.Code, w.Body.String())
+	}
+
+	updated := func() bool {
+		addr, _ := managerB.configuredAddr("managerUpdateC")
+		return addr == "updateC2"
+	}
+	if !waitFor(5*time.Second, updated) {
+		t.Fatalf("expected the address of managerUpdateC to be updated on managerUpdateB")
+	}
+
+	// managerUpdateB drops the connection made to the old address
+	reconnected := func() bool {
+		managerB.connectedNodes.RLock()
+		defer managerB.connectedNodes.RUnlock()
+		node, ok := managerB.connectedNodes.nodes["managerUpdateC"]
+		return !ok || node.joinTime.After(joined)
+	}
+	if !waitFor(5*time.Second, reconnected) {
+		t.Errorf("expected managerUpdateB to reconnect to managerUpdateC after its address changed")
+	}
+}
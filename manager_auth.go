@@ -0,0 +1,271 @@
+package cluster
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Nodes authenticate each other with a challenge/response handshake, so the
+// authentication key is never sent over the connection:
+//
+//  dialer   -> listener: packetAuthRequest{Nonce, Codecs, Version, Compressors}
+//  listener -> dialer:   packetAuthChallenge{Nonce, Proof, Codec, Version, Compressors}
+//  dialer   -> listener: packetAuthProof{Proof}
+//  listener -> dialer:   packetAuthResponse{Status}
+//
+// Each proof is a HMAC over both nonces, so both sides prove they know the key,
+// and a replayed handshake fails as the other side picks a new nonce. The
+// listener only records an error for the node once its proof was verified, as
+// anyone can connect using the name of a configured node.
+//
+// Nodes from before this handshake send no nonce and are rejected, so they can
+// not be upgraded one at a time: all nodes have to be upgraded together.
+//
+// The dialer offers the codecs it supports, and the listener picks the first
+// one it supports as well. After the handshake both sides switch to binary
+// frames with the picked codec, or keep using the JSON newline format if none
+// was picked.
+
+const (
+	authRoleListener = "listener"
+	authRoleDialer   = "dialer"
+)
+
+// newNonce returns a random nonce for the authentication handshake
+func newNonce() (string, error) {
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+// authProof returns the proof that node with role knows the authentication key
+func authProof(authKey, role, node, dialerNonce, listenerNonce string) string {
+	mac := hmac.New(sha256.New, []byte(authKey))
+	mac.Write([]byte(role + "\n" + node + "\n" + dialerNonce + "\n" + listenerNonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validProof compares a received proof with the expected proof in constant time
+func validProof(received, expected string) bool {
+	return hmac.Equal([]byte(received), []byte(expected))
+}
+
+// authError returns the error of an authentication response, if the remote node sent one instead of the expected packet
+func authError(packet *Packet) error {
+	if packet.DataType != "cluster.packetAuthResponse" {
+		return nil
+	}
+
+	authResponse := &packetAuthResponse{}
+	err := packet.Message(authResponse)
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("rejected by remote node: %s", authResponse.Error)
+}
+
+// offeredCodecs returns the codecs we offer when connecting to a node
+func (m *Manager) offeredCodecs() []string {
+	preferred := m.preferredCodec()
+	if preferred == "" {
+		return nil
+	}
+
+	return codecNames(preferred)
+}
+
+// pickCodec returns the first codec offered by a connecting node that we support
+func (m *Manager) pickCodec(offered []string) string {
+	if m.preferredCodec() == "" {
+		return ""
+	}
+
+	for _, codec := range offered {
+		if _, ok := getCodec(codec); ok {
+			return codec
+		}
+	}
+
+	return ""
+}
+
+// rejectAuth informs the remote node its authentication failed
+func (m *Manager) rejectAuth(conn net.Conn, reason string) {
+	authResponse, _ := m.newPacket(packetAuthResponse{Status: false, Error: reason})
+	m.connectedNodes.writeSocket(conn, authResponse)
+}
+
+// authenticateIncomming handles the handshake of a connecting node, and returns the node
+func (m *Manager) authenticateIncomming(conn net.Conn) (*Node, error) {
+	reader := bufio.NewReader(conn)
+	packet, err := m.connectedNodes.readSocket(conn, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed while trying to read from socket: %s", err)
+	}
+
+	// Receive authentication request
+	authRequest := &packetAuthRequest{}
+	err = packet.Message(authRequest)
+	if err != nil {
+		m.rejectAuth(conn, "invalid authentication request")
+		return nil, fmt.Errorf("sent an invalid authentication request: %v", err)
+	}
+
+	if authRequest.Nonce == "" {
+		m.rejectAuth(conn, "authentication without a challenge is not supported, upgrade this node")
+		return nil, fmt.Errorf("%s: uses the authentication from before the challenge/response handshake, which is not supported", packet.Name)
+	}
+
+	// Send our challenge, proving we know the key
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %s", err)
+	}
+
+	codec := m.pickCodec(authRequest.Codecs)
+	challenge, _ := m.newPacket(packetAuthChallenge{
+		Nonce:        nonce,
+		Proof:        authProof(m.authKey, authRoleListener, m.name, authRequest.Nonce, nonce),
+		Codec:        codec,
+		Version:      ProtocolVersion,
+		Library:      LibraryVersion,
+		Capabilities: capabilities(),
+		Compressors:  compressorNames(),
+	})
+	err = m.connectedNodes.writeSocket(conn, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("failed while trying to send an authentication challenge: %s", err)
+	}
+
+	// Receive the proof of the remote node
+	proofPacket, err := m.connectedNodes.readSocket(conn, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed while trying to read authentication proof: %s", err)
+	}
+
+	// the name is not verified yet, so errors are only logged and not recorded for the node
+	if err = authError(proofPacket); err != nil {
+		return nil, fmt.Errorf("%s: %s", packet.Name, err)
+	}
+
+	authProofMessage := &packetAuthProof{}
+	err = proofPacket.Message(authProofMessage)
+	if err != nil || proofPacket.Name != packet.Name ||
+		!validProof(authProofMessage.Proof, authProof(m.authKey, authRoleDialer, packet.Name, authRequest.Nonce, nonce)) {
+		m.rejectAuth(conn, "invalid authentication key")
+		return nil, fmt.Errorf("sent an invalid authentication proof")
+	}
+
+	// only a node that proved it knows the key learns it is administratively down
+	if until := m.dialers.adminDown(packet.Name); !until.IsZero() {
+		m.rejectAuth(conn, "administratively down")
+		return nil, fmt.Errorf("%s: administratively down until %s", packet.Name, until.Format(time.RFC3339))
+	}
+
+	version := newPeerVersion(authRequest.Version, authRequest.Library, authRequest.Capabilities)
+	if err = version.compatible(m.minVersion); err != nil {
+		m.rejectAuth(conn, err.Error())
+		m.setNodeError(packet.Name, err.Error())
+		return nil, fmt.Errorf("%s: %s", packet.Name, err)
+	}
+
+	authResponse, _ := m.newPacket(packetAuthResponse{Status: true})
+	err = m.connectedNodes.writeSocket(conn, authResponse)
+	if err != nil {
+		return nil, fmt.Errorf("failed while trying to send an authentication response: %s", err)
+	}
+
+	framing, _ := newFraming(codec)
+	framing.compressor, framing.threshold = m.compressorFor(authRequest.Compressors)
+	node := newNode(packet.Name, conn, reader, framing, true)
+	node.version = version
+	return node, nil
+}
+
+// authenticateOutgoing handles the handshake with a node we connected to, and returns the node
+func (m *Manager) authenticateOutgoing(conn net.Conn) (*Node, error) {
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %s", err)
+	}
+
+	authRequest, _ := m.newPacket(packetAuthRequest{
+		Nonce:        nonce,
+		Codecs:       m.offeredCodecs(),
+		Version:      ProtocolVersion,
+		Library:      LibraryVersion,
+		Capabilities: capabilities(),
+		Compressors:  compressorNames(),
+	})
+	err = m.connectedNodes.writeSocket(conn, authRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send authentication request: %s", err)
+	}
+
+	// Receive the challenge of the remote node, and verify it knows the key
+	reader := bufio.NewReader(conn)
+	packet, err := m.connectedNodes.readSocket(conn, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authentication challenge: %s", err)
+	}
+
+	if err = authError(packet); err != nil {
+		return nil, err
+	}
+
+	challenge := &packetAuthChallenge{}
+	err = packet.Message(challenge)
+	if err != nil || challenge.Nonce == "" ||
+		!validProof(challenge.Proof, authProof(m.authKey, authRoleListener, packet.Name, nonce, challenge.Nonce)) {
+		return nil, fmt.Errorf("remote node failed to prove it knows the authentication key")
+	}
+
+	version := newPeerVersion(challenge.Version, challenge.Library, challenge.Capabilities)
+	if err = version.compatible(m.minVersion); err != nil {
+		m.rejectAuth(conn, err.Error())
+		return nil, err
+	}
+
+	framing, err := newFraming(challenge.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("remote node picked a codec we do not support: %s", err)
+	}
+	framing.compressor, framing.threshold = m.compressorFor(challenge.Compressors)
+
+	// Send our proof
+	proof, _ := m.newPacket(packetAuthProof{Proof: authProof(m.authKey, authRoleDialer, m.name, nonce, challenge.Nonce)})
+	err = m.connectedNodes.writeSocket(conn, proof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send authentication proof: %s", err)
+	}
+
+	responsePacket, err := m.connectedNodes.readSocket(conn, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authentication response: %s", err)
+	}
+
+	authResponse := &packetAuthResponse{}
+	err = responsePacket.Message(authResponse)
+	if err != nil {
+		return nil, fmt.Errorf("auth response unknown: %s", err)
+	}
+
+	if authResponse.Status != true {
+		return nil, fmt.Errorf("authentication rejected by remote node: %s", authResponse.Error)
+	}
+
+	node := newNode(packet.Name, conn, reader, framing, false)
+	node.version = version
+	return node, nil
+}
@@ -0,0 +1,237 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConn records all data written to a connection
+type recordingConn struct {
+	net.Conn
+	sync.Mutex
+	written bytes.Buffer
+}
+
+func (c *recordingConn) Write(p []byte) (int, error) {
+	c.Lock()
+	c.written.Write(p)
+	c.Unlock()
+	return c.Conn.Write(p)
+}
+
+// handshake authenticates dialer to listener over an in memory connection
+func handshake(dialer, listener *Manager) (dialerConn, listenerConn *recordingConn, dialerErr, listenerErr error) {
+	dialSide, listenSide := net.Pipe()
+	dialerConn = &recordingConn{Conn: dialSide}
+	listenerConn = &recordingConn{Conn: listenSide}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, listenerErr = listener.authenticateIncomming(listenerConn)
+		listenSide.Close()
+	}()
+
+	_, dialerErr = dialer.authenticateOutgoing(dialerConn)
+	dialSide.Close()
+	wg.Wait()
+	return
+}
+
+func TestAuthHandshake(t *testing.T) {
+	managerA := NewManager("managerAuthA", "secret")
+	managerB := NewManager("managerAuthB", "secret")
+	managerC := NewManager("managerAuthC", "wrong")
+
+	dialerConn, listenerConn, dialerErr, listenerErr := handshake(managerA, managerB)
+	if dialerErr != nil || listenerErr != nil {
+		t.Errorf("expected handshake with the same key to succeed, but got dialer:%v listener:%v", dialerErr, listenerErr)
+	}
+
+	if bytes.Contains(dialerConn.written.Bytes(), []byte("secret")) || bytes.Contains(listenerConn.written.Bytes(), []byte("secret")) {
+		t.Errorf("expected the authentication key not to be sent during the handshake")
+	}
+
+	// a listener with a different key can not prove itself to the dialer
+	_, _, dialerErr, listenerErr = handshake(managerA, managerC)
+	if dialerErr == nil {
+		t.Errorf("expected dialer to reject a listener with a different key")
+	}
+
+	// a dialer with a different key is rejected by the listener
+	_, _, dialerErr, listenerErr = handshake(managerC, managerB)
+	if listenerErr == nil || dialerErr == nil {
+		t.Errorf("expected listener to reject a dialer with a different key, but got dialer:%v listener:%v", dialerErr, listenerErr)
+	}
+
+	// only a node that proved it knows the key learns it is administratively down
+	managerB.dialers.setAdminDown("managerAuthC", time.Now().Add(time.Hour))
+	_, _, dialerErr, _ = handshake(managerC, managerB)
+	if dialerErr == nil || strings.Contains(dialerErr.Error(), "administratively down") {
+		t.Errorf("expected a dialer with a different key to be rejected for its key, but got:%v", dialerErr)
+	}
+
+	managerB.dialers.setAdminDown("managerAuthA", time.Now().Add(time.Hour))
+	_, _, dialerErr, _ = handshake(managerA, managerB)
+	if dialerErr == nil || !strings.Contains(dialerErr.Error(), "administratively down") {
+		t.Errorf("expected dialer to be rejected as administratively down, but got:%v", dialerErr)
+	}
+	managerB.dialers.setAdminDown("managerAuthA", time.Time{})
+
+	// replaying a recorded handshake fails, as the listener picks a new nonce
+	replayConn, listenSide := net.Pipe()
+	go func() {
+		managerB.authenticateIncomming(listenSide)
+		listenSide.Close()
+	}()
+	replayed := bytes.SplitAfter(dialerConn.written.Bytes(), []byte("\n"))
+	go func() {
+		for _, packet := range replayed {
+			replayConn.Write(packet)
+		}
+	}()
+	reader := bufio.NewReader(replayConn)
+	response, err := managerA.connectedNodes.readSocket(replayConn, reader) // challenge
+	if err != nil {
+		t.Fatalf("expected a challenge on the replayed handshake, but got:%s", err)
+	}
+	response, err = managerA.connectedNodes.readSocket(replayConn, reader)
+	if err == nil {
+		authResponse := &packetAuthResponse{}
+		response.Message(authResponse)
+		if authResponse.Status {
+			t.Errorf("expected replayed handshake to be rejected")
+		}
+	}
+	replayConn.Close()
+}
+
+func TestHandshakeVersion(t *testing.T) {
+	managerA := NewManager("managerVersionA", "secret")
+	managerB := NewManager("managerVersionB", "secret")
+	managerA.AddNode("managerVersionB", "127.0.0.1:9522")
+	managerB.AddNode("managerVersionA", "127.0.0.1:9523")
+
+	dialSide, listenSide := net.Pipe()
+	var listenerNode *Node
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		listenerNode, _ = managerB.authenticateIncomming(listenSide)
+	}()
+
+	dialerNode, err := managerA.authenticateOutgoing(dialSide)
+	wg.Wait()
+	if err != nil || listenerNode == nil {
+		t.Fatalf("expected handshake to succeed, but got:%v", err)
+	}
+
+	for _, node := range []*Node{dialerNode, listenerNode} {
+		if node.version.protocol != ProtocolVersion || node.version.library != LibraryVersion || !node.version.capabilities[CapabilityReliable] {
+			t.Errorf("expected version of %s to be exchanged, but got:%+v", node.name, node.version)
+		}
+	}
+	dialSide.Close()
+	listenSide.Close()
+
+	// an impostor without the key does not get an error recorded for the node it claims to be
+	managerB.minVersion = ProtocolVersion + 1
+	impostor := NewManager("managerVersionA", "wrong")
+	if _, _, _, listenerErr := handshake(impostor, managerB); listenerErr == nil {
+		t.Errorf("expected listener to reject the impostor")
+	}
+
+	managerB.mu.RLock()
+	nodeError := managerB.configuredNodes["managerVersionA"].errorStr
+	managerB.mu.RUnlock()
+	if nodeError != "" {
+		t.Errorf("expected no error to be recorded for an unverified node, but got:%q", nodeError)
+	}
+
+	// a listener requiring a newer protocol rejects the dialer, both report why
+	_, _, dialerErr, listenerErr := handshake(managerA, managerB)
+	if dialerErr == nil || !strings.Contains(dialerErr.Error(), "incompatible protocol version") {
+		t.Errorf("expected dialer to be rejected for its protocol version, but got:%v", dialerErr)
+	}
+
+	if listenerErr == nil {
+		t.Errorf("expected listener to reject the dialer")
+	}
+
+	managerB.mu.RLock()
+	nodeError = managerB.configuredNodes["managerVersionA"].errorStr
+	managerB.mu.RUnlock()
+	if !strings.Contains(nodeError, "incompatible protocol version") {
+		t.Errorf("expected incompatible version to be reported for managerVersionA, but got:%q", nodeError)
+	}
+
+	// a dialer requiring a newer protocol rejects the listener
+	managerB.minVersion = MinProtocolVersion
+	managerA.minVersion = ProtocolVersion + 1
+	_, _, dialerErr, listenerErr = handshake(managerA, managerB)
+	if dialerErr == nil || listenerErr == nil || !strings.Contains(listenerErr.Error(), "incompatible protocol version") {
+		t.Errorf("expected dialer to reject the listener for its protocol version, but got dialer:%v listener:%v", dialerErr, listenerErr)
+	}
+
+	// nodes from before the challenge/response handshake send no nonce
+	dialSide, listenSide = net.Pipe()
+	go func() {
+		legacy, _ := managerA.newPacket(packetAuthRequest{})
+		managerA.connectedNodes.writeSocket(dialSide, legacy)
+		ioutil.ReadAll(dialSide)
+	}()
+	if _, err := managerB.authenticateIncomming(listenSide); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("expected a node without a nonce to be rejected, but got:%v", err)
+	}
+	listenSide.Close()
+	dialSide.Close()
+
+	// nodes sending no version predate versioning
+	if version := newPeerVersion(0, "", nil); version.compatible(MinProtocolVersion) != nil {
+		t.Errorf("expected unversioned nodes to be compatible, but got:%s", version.compatible(MinProtocolVersion))
+	}
+}
+
+func TestHandshakeSlowClient(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerSlowAuthA", "secret")
+	managerA.UpdateSettings(settings)
+	if err := managerA.ListenAndServeTransport("slowAuthA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	// a client that connects, but never sends its authentication request
+	conn, err := network.Dial("slowAuthA", time.Second)
+	if err != nil {
+		t.Fatalf("expected dial on memory network to work, but got:%s", err)
+	}
+	defer conn.Close()
+
+	managerB := NewManager("managerSlowAuthB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerSlowAuthA", "slowAuthA")
+	if err := managerB.ListenAndServeTransport("slowAuthB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if !waitFor(2*time.Second, func() bool { return managerA.connectedNodes.nodeExists("managerSlowAuthB") }) {
+		t.Errorf("expected managerSlowAuthB to authenticate while another client is slow")
+	}
+}
@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"time"
+)
+
+// Nodes supporting CapabilityRTT answer each ping with a pong, which echoes
+// the time the ping was sent, and holds the time the ping was received and
+// the pong was sent. Like NTP, this gives the round trip time without the time
+// spent by the remote node, and the offset of the clock of the remote node:
+//
+//  rtt    = (pong received - ping sent) - (pong sent - ping received)
+//  offset = ((ping received - ping sent) + (pong sent - pong received)) / 2
+//
+// The offset of the sample with the lowest round trip time of the last
+// clockSamples pings is used, as it has the least network delay.
+
+// clockSamples is the number of round trip measurements used to estimate the clock offset of a node
+const clockSamples = 8
+
+// ClockSkewEvent is sent when the clock of a node differs more than Settings.MaxClockSkew from ours
+type ClockSkewEvent struct {
+	Node   string        // node with a skewed clock
+	Offset time.Duration // how far the clock of the node is ahead of ours, negative if it is behind
+}
+
+// clockSample is a round trip measurement of a ping
+type clockSample struct {
+	rtt    time.Duration
+	offset time.Duration
+}
+
+// newClockSample calculates the round trip time and clock offset of a pong received at time received
+func newClockSample(pong packetPong, received time.Time) clockSample {
+	return clockSample{
+		rtt:    received.Sub(pong.Ping) - pong.Sent.Sub(pong.Received),
+		offset: (pong.Received.Sub(pong.Ping) + pong.Sent.Sub(received)) / 2,
+	}
+}
+
+// handlePing answers a ping with a pong, or records the one way lag for nodes that do not support pongs
+func (m *Manager) handlePing(node string, ping packetPing, received time.Time) {
+	if !m.connectedNodes.hasCapability(node, CapabilityRTT) {
+		m.connectedNodes.setLag(node, received.Sub(ping.Time))
+		return
+	}
+
+	err := m.writeClusterNode(node, packetPong{Ping: ping.Time, Received: received, Sent: time.Now()})
+	if err != nil {
+		m.log("%s Failed to send pong to %s. error: %s", m.name, node, err)
+	}
+}
+
+// handlePong records the round trip time and clock offset of a node
+func (m *Manager) handlePong(node string, pong packetPong, received time.Time) {
+	rtt, offset, ok := m.connectedNodes.addClockSample(node, newClockSample(pong, received))
+	if !ok {
+		return
+	}
+
+	m.log("%s Got pong from node %s (rtt:%v offset:%v)", m.name, node, rtt, offset)
+	maxSkew := m.getDuration("maxclockskew")
+	skewed := maxSkew > 0 && (offset > maxSkew || offset < -maxSkew)
+	if !m.connectedNodes.setSkewed(node, skewed) || !skewed {
+		return
+	}
+
+	m.log("%s Clock of %s is %v off from ours, exceeding the maximum of %v", m.name, node, offset, maxSkew)
+	select {
+	case m.ClockSkew <- ClockSkewEvent{Node: node, Offset: offset}: // warning to client application
+	default:
+	}
+}
@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClockSample(t *testing.T) {
+	// the remote clock is 2 seconds ahead, with 10ms latency each way, and 5ms to answer the ping
+	sent := time.Now()
+	pong := packetPong{
+		Ping:     sent,
+		Received: sent.Add(2*time.Second + 10*time.Millisecond),
+		Sent:     sent.Add(2*time.Second + 15*time.Millisecond),
+	}
+
+	sample := newClockSample(pong, sent.Add(25*time.Millisecond))
+	if sample.rtt != 20*time.Millisecond {
+		t.Errorf("expected rtt of 20ms, but got:%v", sample.rtt)
+	}
+
+	if sample.offset != 2*time.Second {
+		t.Errorf("expected offset of 2s, but got:%v", sample.offset)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerClock", 2, func(settings *Settings) {
+		settings.PingInterval = 50 * time.Millisecond
+	})
+	managerA := managers[0]
+
+	measured := func() bool {
+		managerA.connectedNodes.RLock()
+		defer managerA.connectedNodes.RUnlock()
+		node, ok := managerA.connectedNodes.nodes["managerClock1"]
+		return ok && node.rtt > 0 && len(node.samples) > 0
+	}
+	if !waitFor(5*time.Second, measured) {
+		t.Fatalf("expected round trip time of managerClock1 to be measured")
+	}
+
+	select {
+	case event := <-managerA.ClockSkew:
+		t.Errorf("expected no clock skew between nodes on the same host, but got:%+v", event)
+	default:
+	}
+
+	// a pong of a node with its clock 5 seconds ahead
+	now := time.Now()
+	pong := packetPong{Ping: now, Received: now.Add(5 * time.Second), Sent: now.Add(5 * time.Second)}
+	managerA.handlePong("managerClock1", pong, now)
+
+	select {
+	case event := <-managerA.ClockSkew:
+		if event.Node != "managerClock1" || event.Offset != 5*time.Second {
+			t.Errorf("expected clock skew of 5s for managerClock1, but got:%+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected clock skew event, but got timeout")
+	}
+}
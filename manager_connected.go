@@ -8,7 +8,14 @@ func (m *Manager) handleAuthorizedConnection(node *Node) {
 	// add authorized node if its uniq
 	m.log("%s %s attempting to join (%s)", m.name, node.name, node.conn.RemoteAddr())
 
+	node.detector = newPhiDetector(m.getDuration("pinginterval"), m.getDuration("acceptablepause"))
 	oldNode, err := m.connectedNodes.nodeAdd(node)
+	if err != nil && oldNode == nil { // the manager is shutting down
+		m.log("%s %s", m.name, err)
+		node.close()
+		return
+	}
+
 	if err != nil { // err means we already have a node with this name, node was not added
 
 		var oldConnection, oldDirection string
@@ -40,6 +47,8 @@ func (m *Manager) handleAuthorizedConnection(node *Node) {
 		_, err = m.connectedNodes.nodeAdd(node) // again add new node to replace it
 		if err != nil {
 			m.log("%s %s failed to be re-added as the active node: %s", m.name, node.name, err)
+			node.close()
+			return
 		}
 	}
 
@@ -55,16 +64,20 @@ func (m *Manager) handleAuthorizedConnection(node *Node) {
 
 	// start pinger in the background
 	m.log("%s %s Starting pinger (%s)", m.name, node.name, node.conn.RemoteAddr())
-	go m.pinger(node)
+	m.spawn(func() {
+		m.pinger(node)
+	})
 
 	// send join
-	m.internalMessage <- internalMessage{Type: "nodejoin", Node: node.name}
+	m.sendInternal(internalMessage{Type: "nodejoin", Node: node.name})
 	// wait for data till connection is closed
 	m.connectedNodes.setStatus(node.name, StatusOnline)
 	m.connectedNodes.setStatusError(node.name, "")
+	m.setNodeError(node.name, "")
 	m.log("%s %s joined, started ioReader (%s) (timeout:%v)", m.name, node.name, node.conn.RemoteAddr(), m.getDuration("readtimeout"))
 	err = node.ioReader(m.incommingPackets, m.getDuration("readtimeout"), node.quit)
 	m.log("%s %s ioReader failed (%s) (%s)", m.name, node.name, node.conn.RemoteAddr(), err)
+	shutdown := m.connectedNodes.getStatus(node.name) == StatusShutdown
 	m.connectedNodes.setStatus(node.name, StatusLeaving)
 	m.connectedNodes.setStatusError(node.name, err.Error())
 
@@ -74,7 +87,17 @@ func (m *Manager) handleAuthorizedConnection(node *Node) {
 	node.close()
 
 	// send leave
-	m.internalMessage <- internalMessage{Type: "nodeleave", Node: node.name, Error: err.Error()}
+	m.sendInternal(internalMessage{Type: "nodeleave", Node: node.name, Error: err.Error()})
+	// only report the node as failed if other nodes can not reach it either
+	m.confirmFailure(node.name, err.Error(), shutdown)
+}
+
+// sendInternal passes an internal message to the packet manager, unless the manager is shutting down
+func (m *Manager) sendInternal(message internalMessage) {
+	select {
+	case m.internalMessage <- message:
+	case <-m.quit:
+	}
 }
 
 func (m *Manager) pinger(node *Node) {
@@ -86,37 +109,27 @@ func (m *Manager) pinger(node *Node) {
 		default:
 		}
 
-		p, _ := m.newPacket(&packetPing{Time: time.Now()})
 		m.log("%s Sending ping to %s (%s)", m.name, node.name, node.conn.RemoteAddr())
-		err := m.connectedNodes.writeSocket(node.conn, p)
+		err := node.write(m.packetFor(&packetPing{Time: time.Now()}))
 		if err != nil {
 			m.log("%s Failed to send ping to %s (%s). Error:%s", m.name, node.name, node.conn.RemoteAddr(), err.Error())
 			node.close()
 			return
 		}
 
-		time.Sleep(m.getDuration("pinginterval"))
+		select {
+		case <-node.quit:
+		case <-time.After(m.getDuration("pinginterval")):
+		}
 	}
 }
 
 func (m *Manager) writeCluster(dataMessage interface{}) error {
 	//nodes := connected.getActiveNodes()
-	packet, err := m.newPacket(dataMessage)
-	if err != nil {
-		return err
-	}
-
-	err = m.connectedNodes.writeAll(packet)
-	return err
+	return m.connectedNodes.writeAll(m.packetFor(dataMessage))
 
 }
 
 func (m *Manager) writeClusterNode(node string, dataMessage interface{}) error {
-	packet, err := m.newPacket(dataMessage)
-	if err != nil {
-		return err
-	}
-
-	err = m.connectedNodes.write(node, packet)
-	return err
+	return m.connectedNodes.write(node, m.packetFor(dataMessage))
 }
@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"sync"
+)
+
+// Reliable packets are handed to their handler or the client application by
+// a goroutine per node, so a slow handler or reader of FromCluster does not
+// stall the packet manager, and with it the pings, acknowledgements and
+// membership of the whole cluster. A packet is only acknowledged once its
+// handler returned, or the application accepted it.
+// When the queue of a node is full, the connection to the node is closed and
+// the packets we did not queue are resent by the node when it reconnects.
+
+// delivery is a reliable packet waiting to be handed to the client application
+type delivery struct {
+	packet  Packet
+	ackOnly bool // a duplicate, acknowledged once the packets queued before it are delivered
+}
+
+// deliveryPool keeps the reliable packets waiting to be delivered per node
+type deliveryPool struct {
+	sync.Mutex
+	queues  map[string][]delivery
+	running map[string]bool // wether a goroutine is delivering the packets of a node
+}
+
+func newDeliveryPool() *deliveryPool {
+	d := &deliveryPool{
+		queues:  make(map[string][]delivery),
+		running: make(map[string]bool),
+	}
+	return d
+}
+
+// push queues a delivery for node, returns false if the queue is full, and true for start if a goroutine needs to be started
+func (d *deliveryPool) push(node string, item delivery) (ok, start bool) {
+	d.Lock()
+	defer d.Unlock()
+	if len(d.queues[node]) >= ReliableQueueSize {
+		return false, false
+	}
+
+	d.queues[node] = append(d.queues[node], item)
+	if d.running[node] {
+		return true, false
+	}
+
+	d.running[node] = true
+	return true, true
+}
+
+// pop returns the next delivery of node, it returns false and marks the goroutine as stopped once the queue is empty
+func (d *deliveryPool) pop(node string) (delivery, bool) {
+	d.Lock()
+	defer d.Unlock()
+	queue := d.queues[node]
+	if len(queue) == 0 {
+		delete(d.queues, node)
+		delete(d.running, node)
+		return delivery{}, false
+	}
+
+	d.queues[node] = queue[1:]
+	return queue[0], true
+}
+
+// queueDelivery queues a reliable packet to be delivered and acknowledged, returns false if the queue of the node is full
+func (m *Manager) queueDelivery(item delivery) bool {
+	node := item.packet.Name
+	ok, start := m.deliveries.push(node, item)
+	if !ok {
+		m.log("%s Delivery queue for %s is full, closing the connection so unacknowledged packets are resent", m.name, node)
+		if item.packet.from != nil {
+			item.packet.from.close()
+		} else {
+			m.connectedNodes.close(node)
+		}
+		return false
+	}
+
+	if start {
+		m.spawn(func() {
+			m.deliverReliable(node)
+		})
+	}
+	return true
+}
+
+// deliverReliable hands the queued reliable packets of node to their handler or the client application, and acknowledges them
+func (m *Manager) deliverReliable(node string) {
+	for {
+		item, ok := m.deliveries.pop(node)
+		if !ok {
+			return
+		}
+
+		if !item.ackOnly && !m.deliver(item.packet) {
+			return // not acknowledged, so the node sends it again when we are back
+		}
+
+		m.ackReliable(item.packet)
+	}
+}
+
+// deliver passes a reliable packet to its handler, or to the client application if there is none, returns false on shutdown
+func (m *Manager) deliver(packet Packet) bool {
+	if handled, stopped := m.handleReliable(packet); handled {
+		return !stopped
+	}
+
+	select {
+	case m.FromCluster <- packet: // outgoing to client application
+		return true
+	case <-m.quit:
+		return false
+	}
+}
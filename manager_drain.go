@@ -0,0 +1,29 @@
+package cluster
+
+// Drain announces to the cluster that this node is about to leave
+// Other nodes receive the name of this node on their NodeDrain channel, and
+// show its status as StatusDraining, so applications can move work away from
+// it before it shuts down. A draining node gives up leadership of the cluster,
+// unless all nodes are draining. Nodes connecting later are informed as well.
+func (m *Manager) Drain() {
+	m.mu.Lock()
+	if m.draining {
+		m.mu.Unlock()
+		return
+	}
+	m.draining = true
+	m.mu.Unlock()
+
+	m.log("%s Draining, informing the cluster", m.name)
+	if err := m.writeCluster(packetNodeDrain{}); err != nil {
+		m.log("%s Failed to send drain notice to the cluster. error: %s", m.name, err)
+	}
+	m.electLeader()
+}
+
+// IsDraining returns true if this node is draining before it leaves the cluster
+func (m *Manager) IsDraining() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.draining
+}
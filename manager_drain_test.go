@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerDrain", 3)
+
+	leaderIs := func(leader string) func() bool {
+		return func() bool {
+			for _, manager := range managers {
+				if manager.Leader() != leader {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	if !waitFor(5*time.Second, leaderIs("managerDrain2")) {
+		t.Fatalf("expected managerDrain2 to be the leader")
+	}
+
+	// the leader drains, and hands over the leadership
+	managers[2].Drain()
+	if !managers[2].IsDraining() {
+		t.Errorf("expected managerDrain2 to be draining")
+	}
+
+	for _, manager := range managers[:2] {
+		node, timeout := channelReadString(manager.NodeDrain, 2)
+		if timeout || node != "managerDrain2" {
+			t.Errorf("expected NodeDrain of managerDrain2 on %s, but got:%s (timeout:%t)", manager.name, node, timeout)
+		}
+
+		if status := manager.connectedNodes.getStatus("managerDrain2"); status != StatusDraining {
+			t.Errorf("expected status %s of managerDrain2 on %s, but got:%s", StatusDraining, manager.name, status)
+		}
+	}
+
+	if !waitFor(5*time.Second, leaderIs("managerDrain1")) {
+		t.Errorf("expected managerDrain1 to take over the leadership, but got:%s %s %s", managers[0].Leader(), managers[1].Leader(), managers[2].Leader())
+	}
+}
@@ -0,0 +1,142 @@
+package cluster
+
+import (
+	"math/rand"
+	"net"
+	"time"
+)
+
+// The cluster membership is shared between nodes using gossip. Each node
+// advertises itself, and changes made with AddNode and RemoveNode are sent to
+// all connected nodes, which forward what they did not know yet. Periodically
+// the full membership is exchanged with a random node to repair missed
+// updates. A new node therefore only needs to be configured with one seed node.
+
+// member is an entry of the cluster membership, the newest version of an entry wins
+type member struct {
+	Name    string       `json:"name"`
+	Addr    string       `json:"addr"`
+	Removed bool         `json:"removed"`
+	Version hlcTimestamp `json:"version"`
+}
+
+// gossip periodically sends the full membership to a random connected node
+func (m *Manager) gossip() {
+	m.updateMember(m.name, m.addr, false) // advertise ourselves
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-time.After(m.getDuration("gossipinterval")):
+		}
+
+		nodes := m.connectedNodes.nodeNames()
+		if len(nodes) == 0 {
+			continue
+		}
+
+		m.sendMembers(nodes[rand.Intn(len(nodes))])
+	}
+}
+
+// updateMember creates a new version of a membership entry, and sends it to the cluster
+func (m *Manager) updateMember(name, addr string, removed bool) {
+	entry := member{Name: name, Addr: addr, Removed: removed, Version: m.kv.clock.now()}
+	m.mu.Lock()
+	m.members[name] = entry
+	m.mu.Unlock()
+
+	err := m.writeCluster(packetMembers{Members: []member{entry}})
+	if err != nil {
+		m.log("%s Failed to send membership of %s to the cluster. error: %s", m.name, name, err)
+	}
+}
+
+// sendMembers sends the full membership to a node
+func (m *Manager) sendMembers(node string) {
+	var members []member
+	m.mu.RLock()
+	for _, entry := range m.members {
+		members = append(members, entry)
+	}
+	m.mu.RUnlock()
+
+	err := m.writeClusterNode(node, packetMembers{Members: members})
+	if err != nil {
+		m.log("%s Failed to send cluster membership to %s. error: %s", m.name, node, err)
+	}
+}
+
+// mergeMembers applies membership entries received from a node, and forwards the ones that were new to us
+func (m *Manager) mergeMembers(node string, members []member) {
+	var changed []member
+	for _, entry := range members {
+		m.kv.clock.update(entry.Version)
+		if entry.Name == m.name {
+			continue // we decide on our own membership
+		}
+
+		if entry.Name == node && !entry.Removed {
+			entry.Addr = m.memberAddr(node, entry.Addr)
+		}
+
+		m.mu.Lock()
+		known, ok := m.members[entry.Name]
+		if ok && !entry.Version.after(known.Version) {
+			m.mu.Unlock()
+			continue
+		}
+
+		m.members[entry.Name] = entry
+		configured, isConfigured := m.configuredNodes[entry.Name]
+		m.mu.Unlock()
+
+		changed = append(changed, entry)
+		switch {
+		case entry.Removed && isConfigured:
+			m.log("%s Learned removal of node %s from %s", m.name, entry.Name, node)
+			m.removeNode(entry.Name)
+
+		case !entry.Removed && (!isConfigured || configured.addr != entry.Addr):
+			m.log("%s Learned node %s (%s) from %s", m.name, entry.Name, entry.Addr, node)
+			m.addNode(entry.Name, entry.Addr)
+			if isConfigured && entry.Name != node && m.connectedNodes.nodeExists(entry.Name) {
+				// the address of the node was changed, connect to it on its new address
+				m.Reconnect(entry.Name)
+			}
+		}
+	}
+
+	if len(changed) == 0 {
+		return
+	}
+
+	err := m.writeCluster(packetMembers{Members: changed})
+	if err != nil {
+		m.log("%s Failed to forward cluster membership. error: %s", m.name, err)
+	}
+}
+
+// memberAddr replaces an unspecified host in the address a node advertises with the address it connects from
+func (m *Manager) memberAddr(node, addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+		return addr
+	}
+
+	conn, err := m.connectedNodes.getSocket(node)
+	if err != nil {
+		return addr
+	}
+
+	remoteHost, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return addr
+	}
+
+	return net.JoinHostPort(remoteHost, port)
+}
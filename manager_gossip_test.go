@@ -0,0 +1,61 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestGossipMembership(t *testing.T) {
+	t.Parallel()
+
+	// managerGossipA is the seed, and does not know any other node
+	managerA := NewManager("managerGossipA", "secret")
+	err := managerA.ListenAndServe("127.0.0.1:9519")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	managerB := NewManager("managerGossipB", "secret")
+	managerB.AddNode("managerGossipA", "127.0.0.1:9519")
+	err = managerB.ListenAndServe("127.0.0.1:9520")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	managerC := NewManager("managerGossipC", "secret")
+	managerC.AddNode("managerGossipA", "127.0.0.1:9519")
+	err = managerC.ListenAndServe("127.0.0.1:9521")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	converged := waitFor(10*time.Second, func() bool {
+		return managerA.NodeConfigured("managerGossipB") && managerA.NodeConfigured("managerGossipC") &&
+			managerB.NodeConfigured("managerGossipC") && managerC.NodeConfigured("managerGossipB")
+	})
+	if !converged {
+		t.Errorf("expected membership to converge, but got A:%v B:%v C:%v", managerA.NodesConfigured(), managerB.NodesConfigured(), managerC.NodesConfigured())
+	}
+
+	// removals are propagated as well
+	managerA.RemoveNode("managerGossipC")
+	removed := waitFor(5*time.Second, func() bool {
+		return !managerB.NodeConfigured("managerGossipC")
+	})
+	if !removed {
+		t.Errorf("expected managerGossipC to be removed from managerGossipB, but got:%v", managerB.NodesConfigured())
+	}
+
+	logs := channelReadStrings(managerA.Log, 1)
+	if DebugLog == 1 || t.Failed() {
+		for _, log := range logs {
+			t.Log("== LOG managerGossipA: ", log)
+		}
+	}
+
+	managerA.Shutdown(context.Background())
+	managerB.Shutdown(context.Background())
+	managerC.Shutdown(context.Background())
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+)
+
+var (
+	// HandlerWorkers is the number of workers running the handlers registered with Handle
+	HandlerWorkers = 4
+)
+
+// messageHandler is a handler registered with Handle
+type messageHandler struct {
+	msgType reflect.Type  // type the message is decoded in to
+	pointer bool          // wether the handler accepts a pointer to the message
+	fn      reflect.Value // func(from string, msg T)
+}
+
+// handlerJob is a packet waiting for its handler
+type handlerJob struct {
+	packet  Packet
+	handler messageHandler
+	done    chan struct{} // closed once the handler returned, nil if nobody waits for it
+}
+
+type handlerPool struct {
+	sync.RWMutex
+	handlers map[string]messageHandler // handlers per data type
+	workers  []chan handlerJob
+}
+
+func newHandlerPool(workers int) *handlerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	h := &handlerPool{
+		handlers: make(map[string]messageHandler),
+		workers:  make([]chan handlerJob, workers),
+	}
+	for i := range h.workers {
+		h.workers[i] = make(chan handlerJob, ChannelBufferSize)
+	}
+	return h
+}
+
+func (h *handlerPool) register(dataType string, handler messageHandler) {
+	h.Lock()
+	defer h.Unlock()
+	h.handlers[dataType] = handler
+}
+
+func (h *handlerPool) get(dataType string) (messageHandler, bool) {
+	h.RLock()
+	defer h.RUnlock()
+	handler, ok := h.handlers[dataType]
+	return handler, ok
+}
+
+// worker returns the queue of the worker handling packets of node, so packets of a node are handled in order
+func (h *handlerPool) worker(node string) chan handlerJob {
+	hash := fnv.New32a()
+	hash.Write([]byte(node))
+	return h.workers[hash.Sum32()%uint32(len(h.workers))]
+}
+
+// Handle registers handler for messages of the same type as prototype
+// The handler must be a func(from string, msg T) or func(from string, msg *T),
+// where T is the type of prototype. Received messages are decoded and passed to
+// the handler on a pool of HandlerWorkers workers, instead of the FromCluster channel.
+// Messages of a node are handled in the order they were received.
+func (m *Manager) Handle(prototype interface{}, handler interface{}) error {
+	if prototype == nil {
+		return fmt.Errorf("unable to register handler without a prototype")
+	}
+
+	msgType := indirectType(prototype)
+
+	fn := reflect.ValueOf(handler)
+	if fn.Kind() != reflect.Func || fn.Type().NumIn() != 2 || fn.Type().NumOut() != 0 || fn.Type().In(0) != reflect.TypeOf("") {
+		return fmt.Errorf("handler for %s must be a func(from string, msg %s), got %T", msgType, msgType, handler)
+	}
+
+	h := messageHandler{msgType: msgType, fn: fn}
+	switch fn.Type().In(1) {
+	case msgType:
+	case reflect.PtrTo(msgType):
+		h.pointer = true
+	default:
+		return fmt.Errorf("handler for %s accepts messages of type %s", msgType, fn.Type().In(1))
+	}
+
+	m.handlers.register(dataTypeOf(prototype), h)
+	return nil
+}
+
+// dispatchHandler queues packet for the handler of its data type, returns false if there is none
+// The packet is dropped if the queue of the handler is full, reliable packets are handled by handleReliable instead.
+func (m *Manager) dispatchHandler(packet Packet) bool {
+	handler, ok := m.handlers.get(packet.DataType)
+	if !ok {
+		return false
+	}
+
+	select {
+	case m.handlers.worker(packet.Name) <- handlerJob{packet: packet, handler: handler}:
+	default:
+		m.log("%s unable to handle %s of %s, handler queue full!", m.name, packet.DataType, packet.Name)
+	}
+	return true
+}
+
+// handleReliable passes a reliable packet to the handler of its data type, and waits until the handler returned
+// It returns false if there is no handler, and true for stopped if we are shutting down before the handler returned.
+func (m *Manager) handleReliable(packet Packet) (handled, stopped bool) {
+	handler, ok := m.handlers.get(packet.DataType)
+	if !ok {
+		return false, false
+	}
+
+	done := make(chan struct{})
+	select {
+	case m.handlers.worker(packet.Name) <- handlerJob{packet: packet, handler: handler, done: done}:
+	case <-m.quit:
+		return true, true
+	}
+
+	select {
+	case <-done:
+		return true, false
+	case <-m.quit:
+		return true, true
+	}
+}
+
+// handlerWorker runs the handlers of queued packets
+func (m *Manager) handlerWorker(jobs chan handlerJob) {
+	for {
+		select {
+		case job := <-jobs:
+			m.runHandler(job)
+			if job.done != nil {
+				close(job.done)
+			}
+		case <-m.quit:
+			return
+		}
+	}
+}
+
+func (m *Manager) runHandler(job handlerJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			m.log("%s Handler for %s of %s failed: %v", m.name, job.packet.DataType, job.packet.Name, r)
+		}
+	}()
+
+	message := reflect.New(job.handler.msgType)
+	if err := job.packet.Message(message.Interface()); err != nil {
+		m.log("%s Unable to decode %s from %s: %s", m.name, job.packet.DataType, job.packet.Name, err)
+		return
+	}
+
+	if !job.handler.pointer {
+		message = message.Elem()
+	}
+	job.handler.fn.Call([]reflect.Value{reflect.ValueOf(job.packet.Name), message})
+}
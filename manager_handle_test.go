@@ -0,0 +1,146 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type handledMessage struct {
+	Value int `json:"value"`
+}
+
+func TestHandle(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerHandle", 2)
+
+	sender, receiver := managers[0], managers[1]
+	received := make(chan handledMessage, 10)
+	err := receiver.Handle(handledMessage{}, func(from string, msg *handledMessage) {
+		if from != "managerHandle0" {
+			t.Errorf("expected message from managerHandle0, but got:%s", from)
+		}
+		received <- *msg
+	})
+	if err != nil {
+		t.Fatalf("expected handler to register, but got:%s", err)
+	}
+
+	if !waitFor(5*time.Second, func() bool { return len(sender.connectedNodes.getAllNodes()) == 1 }) {
+		t.Fatalf("expected managers to connect")
+	}
+
+	for i := 0; i < 5; i++ {
+		sender.ToClusterReliable <- handledMessage{Value: i}
+	}
+
+	for i := 0; i < 5; i++ {
+		select {
+		case msg := <-received:
+			if msg.Value != i {
+				t.Errorf("expected message %d in order, but got:%d", i, msg.Value)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected message %d to be handled, but got timeout", i)
+		}
+	}
+
+	select {
+	case packet := <-receiver.FromCluster:
+		t.Errorf("expected handled messages not to be sent to FromCluster, but got:%+v", packet)
+	default:
+	}
+}
+
+func TestHandleSlow(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	sender := NewManager("managerHandleSlowA", "secret")
+	sender.UpdateSettings(settings)
+	sender.AddNode("managerHandleSlowB", "handleSlowB")
+	if err := sender.ListenAndServeTransport("handleSlowA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer sender.Shutdown(context.Background())
+
+	receiver := NewManager("managerHandleSlowB", "secret")
+	receiver.UpdateSettings(settings)
+	receiver.AddNode("managerHandleSlowA", "handleSlowA")
+	release := make(chan struct{})
+	receiver.Handle(handledMessage{}, func(from string, msg handledMessage) {
+		<-release
+	})
+	if err := receiver.ListenAndServeTransport("handleSlowB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer receiver.Shutdown(context.Background())
+
+	if _, timeout := channelReadString(sender.NodeJoin, 5); timeout {
+		t.Fatalf("expected managerHandleSlowB to join")
+	}
+
+	// more messages than fit in the queue of the handler
+	messages := ChannelBufferSize + 50
+	for i := 0; i < messages; i++ {
+		sender.ToClusterReliable <- handledMessage{Value: i}
+	}
+
+	pending := func() int {
+		sender.reliable.Lock()
+		defer sender.reliable.Unlock()
+		return len(sender.reliable.pending["managerHandleSlowB"])
+	}
+	queued := func() int {
+		receiver.deliveries.Lock()
+		defer receiver.deliveries.Unlock()
+		return len(receiver.deliveries.queues["managerHandleSlowA"])
+	}
+	if !waitFor(5*time.Second, func() bool { return queued() == messages-1 }) { // the first is being handled
+		t.Fatalf("expected managerHandleSlowB to queue all messages, but got:%d", queued())
+	}
+
+	// the packet manager of managerHandleSlowB still answers requests
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := sender.Call(ctx, "managerHandleSlowB", packetProbe{}, nil); err != nil {
+		t.Errorf("expected managerHandleSlowB to answer while its handler is slow, but got:%s", err)
+	}
+
+	// messages are only acknowledged once their handler returned
+	if n := pending(); n != messages {
+		t.Errorf("expected %d unacknowledged messages, but got:%d", messages, n)
+	}
+
+	close(release)
+	if !waitFor(5*time.Second, func() bool { return pending() == 0 }) {
+		t.Errorf("expected all messages to be acknowledged, but got:%d pending", pending())
+	}
+}
+
+func TestHandleInvalid(t *testing.T) {
+	manager := NewManager("managerHandleInvalid", "secret")
+	defer removeManager(manager.name)
+
+	handlers := []interface{}{
+		nil,
+		"not a func",
+		func(msg handledMessage) {},
+		func(from string, msg publishedMessage) {},
+		func(from string, msg handledMessage) error { return nil },
+	}
+	for _, handler := range handlers {
+		if err := manager.Handle(handledMessage{}, handler); err == nil {
+			t.Errorf("expected handler %T to be rejected", handler)
+		}
+	}
+
+	if err := manager.Handle(&handledMessage{}, func(from string, msg handledMessage) {}); err != nil {
+		t.Errorf("expected handler accepting a value to register, but got:%s", err)
+	}
+}
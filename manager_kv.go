@@ -0,0 +1,223 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The replicated key/value store keeps a copy of all keys on every node.
+// Each write is versioned with a hybrid logical clock, and the newest version
+// of a key wins, so concurrent writes converge to the same value on all nodes.
+// Writes are sent to the cluster with acknowledged delivery, and nodes exchange
+// their full state when they join.
+
+// KVEvent is sent to watchers of the key/value store when a key changes
+type KVEvent struct {
+	Key     string // key that changed
+	Value   []byte // new value of the key
+	Deleted bool   // true if the key was deleted
+	Node    string // node that made the change
+}
+
+// hlcTimestamp is a hybrid logical clock timestamp
+type hlcTimestamp struct {
+	Wall    int64  `json:"wall"`    // physical time in nanoseconds
+	Logical uint32 `json:"logical"` // logical counter for events within the same physical time
+	Node    string `json:"node"`    // node that created the timestamp, breaks ties
+}
+
+// after returns true if timestamp t is newer than o
+func (t hlcTimestamp) after(o hlcTimestamp) bool {
+	if t.Wall != o.Wall {
+		return t.Wall > o.Wall
+	}
+
+	if t.Logical != o.Logical {
+		return t.Logical > o.Logical
+	}
+
+	return t.Node > o.Node
+}
+
+// hybridClock generates hybrid logical clock timestamps
+type hybridClock struct {
+	sync.Mutex
+	node string
+	last hlcTimestamp
+}
+
+// now returns a timestamp newer than all timestamps seen before
+func (c *hybridClock) now() hlcTimestamp {
+	c.Lock()
+	defer c.Unlock()
+	wall := time.Now().UnixNano()
+	if wall > c.last.Wall {
+		c.last = hlcTimestamp{Wall: wall, Node: c.node}
+	} else {
+		c.last = hlcTimestamp{Wall: c.last.Wall, Logical: c.last.Logical + 1, Node: c.node}
+	}
+
+	return c.last
+}
+
+// update moves the clock forward past a timestamp received from another node
+func (c *hybridClock) update(remote hlcTimestamp) {
+	c.Lock()
+	defer c.Unlock()
+	if remote.Wall > c.last.Wall || (remote.Wall == c.last.Wall && remote.Logical > c.last.Logical) {
+		c.last = hlcTimestamp{Wall: remote.Wall, Logical: remote.Logical, Node: c.node}
+	}
+}
+
+// kvEntry is a versioned key/value entry, deleted entries are kept so deletes replicate
+type kvEntry struct {
+	Key     string       `json:"key"`
+	Value   []byte       `json:"value"`
+	Deleted bool         `json:"deleted"`
+	Version hlcTimestamp `json:"version"`
+}
+
+type kvWatcher struct {
+	prefix string
+	events chan KVEvent
+}
+
+type kvStore struct {
+	sync.RWMutex
+	clock    *hybridClock
+	entries  map[string]kvEntry
+	watchers []kvWatcher
+}
+
+func newKVStore(node string) *kvStore {
+	k := &kvStore{
+		clock:   &hybridClock{node: node},
+		entries: make(map[string]kvEntry),
+	}
+	return k
+}
+
+// apply stores an entry if it is newer than the existing one, and returns true if it was stored
+func (k *kvStore) apply(entry kvEntry) bool {
+	k.clock.update(entry.Version)
+	k.Lock()
+	defer k.Unlock()
+	if existing, ok := k.entries[entry.Key]; ok && !entry.Version.after(existing.Version) {
+		return false
+	}
+
+	k.entries[entry.Key] = entry
+	event := KVEvent{Key: entry.Key, Value: entry.Value, Deleted: entry.Deleted, Node: entry.Version.Node}
+	for _, watcher := range k.watchers {
+		if strings.HasPrefix(entry.Key, watcher.prefix) && !reservedKey(entry.Key) {
+			select {
+			case watcher.events <- event:
+			default:
+			}
+		}
+	}
+
+	return true
+}
+
+func (k *kvStore) get(key string) ([]byte, bool) {
+	k.RLock()
+	defer k.RUnlock()
+	entry, ok := k.entries[key]
+	if !ok || entry.Deleted {
+		return nil, false
+	}
+
+	return entry.Value, true
+}
+
+func (k *kvStore) getAll() (entries []kvEntry) {
+	k.RLock()
+	defer k.RUnlock()
+	for _, entry := range k.entries {
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func (k *kvStore) watch(prefix string) chan KVEvent {
+	k.Lock()
+	defer k.Unlock()
+	events := make(chan KVEvent, ChannelBufferSize)
+	k.watchers = append(k.watchers, kvWatcher{prefix: prefix, events: events})
+	return events
+}
+
+func (k *kvStore) unwatch(events chan KVEvent) {
+	k.Lock()
+	defer k.Unlock()
+	var watchers []kvWatcher
+	for _, watcher := range k.watchers {
+		if watcher.events != events {
+			watchers = append(watchers, watcher)
+		}
+	}
+
+	k.watchers = watchers
+}
+
+// reservedKey returns true for keys only written by the cluster itself, such as the replicated locks
+func reservedKey(key string) bool {
+	return strings.HasPrefix(key, lockKeyPrefix)
+}
+
+// Put sets the value of key on all nodes of the cluster
+// An error means the update could not be sent to all nodes yet, it will be resent when they reconnect
+func (m *Manager) Put(key string, value []byte) error {
+	if reservedKey(key) {
+		return fmt.Errorf("key %s is reserved for internal use", key)
+	}
+
+	return m.writeKV(kvEntry{Key: key, Value: value})
+}
+
+// Delete removes key from all nodes of the cluster
+func (m *Manager) Delete(key string) error {
+	if reservedKey(key) {
+		return fmt.Errorf("key %s is reserved for internal use", key)
+	}
+
+	return m.writeKV(kvEntry{Key: key, Deleted: true})
+}
+
+// Get returns the value of key, and false if the key does not exist
+func (m *Manager) Get(key string) ([]byte, bool) {
+	if reservedKey(key) {
+		return nil, false
+	}
+
+	return m.kv.get(key)
+}
+
+// Watch returns a channel receiving all changes to keys starting with prefix
+// Events are dropped if the channel is full, reserved keys are not watched
+func (m *Manager) Watch(prefix string) chan KVEvent {
+	return m.kv.watch(prefix)
+}
+
+// Unwatch stops sending events to a channel returned by Watch
+func (m *Manager) Unwatch(events chan KVEvent) {
+	m.kv.unwatch(events)
+}
+
+func (m *Manager) writeKV(entry kvEntry) error {
+	entry.Version = m.kv.clock.now()
+	m.kv.apply(entry)
+	return m.writeClusterReliable(packetKVUpdate{Entry: entry})
+}
+
+// syncKV sends our full key/value state to a node
+func (m *Manager) syncKV(node string) {
+	err := m.writeClusterNode(node, packetKVSync{Entries: m.kv.getAll()})
+	if err != nil {
+		m.log("%s Failed to sync key/value store to %s. error: %s", m.name, node, err)
+	}
+}
@@ -0,0 +1,141 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestKVStore(t *testing.T) {
+	k := newKVStore("node1")
+	events := k.watch("config/")
+
+	older := hlcTimestamp{Wall: 1, Node: "node2"}
+	newer := hlcTimestamp{Wall: 1, Logical: 1, Node: "node1"}
+
+	if !k.apply(kvEntry{Key: "config/a", Value: []byte("new"), Version: newer}) {
+		t.Errorf("expected first write of config/a to be applied")
+	}
+
+	if k.apply(kvEntry{Key: "config/a", Value: []byte("old"), Version: older}) {
+		t.Errorf("expected older write of config/a to be discarded")
+	}
+
+	if value, ok := k.get("config/a"); !ok || string(value) != "new" {
+		t.Errorf("expected config/a to be 'new', but got:%s", value)
+	}
+
+	k.apply(kvEntry{Key: "other/a", Value: []byte("value"), Version: newer})
+	select {
+	case event := <-events:
+		if event.Key != "config/a" {
+			t.Errorf("expected watch event for config/a, but got:%s", event.Key)
+		}
+	default:
+		t.Errorf("expected watch event for config/a, but got none")
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("expected no watch event for keys outside of prefix, but got:%s", event.Key)
+	default:
+	}
+
+	// the clock moves past timestamps we have seen
+	if now := k.clock.now(); !now.after(newer) {
+		t.Errorf("expected clock to be after %+v, but got:%+v", newer, now)
+	}
+}
+
+func TestKVReserved(t *testing.T) {
+	manager := NewManager("managerKVReserved", "secret")
+	defer removeManager(manager.name)
+	events := manager.Watch("")
+
+	if err := manager.Put("cluster.lock.x", []byte("forged")); err == nil {
+		t.Errorf("expected put of a reserved key to fail")
+	}
+
+	if err := manager.Delete("cluster.lock.x"); err == nil {
+		t.Errorf("expected delete of a reserved key to fail")
+	}
+
+	// locks are written internally, but are not visible to the application
+	if err := manager.writeKV(kvEntry{Key: "cluster.lock.x", Value: []byte("{}")}); err != nil {
+		t.Fatalf("expected internal write of a reserved key to work, but got:%s", err)
+	}
+
+	if _, ok := manager.Get("cluster.lock.x"); ok {
+		t.Errorf("expected get of a reserved key to return nothing")
+	}
+
+	select {
+	case event := <-events:
+		t.Errorf("expected no watch event for a reserved key, but got:%s", event.Key)
+	default:
+	}
+}
+
+func TestKVReplication(t *testing.T) {
+	t.Parallel()
+
+	managerA := NewManager("managerKVA", "secret")
+	managerA.AddNode("managerKVB", "127.0.0.1:9518")
+	err := managerA.ListenAndServe("127.0.0.1:9517")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// written before managerKVB is running, should be synced on join
+	managerA.Put("config/a", []byte("value a"))
+	managerA.Put("config/b", []byte("value b"))
+	managerA.Delete("config/b")
+
+	managerB := NewManager("managerKVB", "secret")
+	managerB.AddNode("managerKVA", "127.0.0.1:9517")
+	events := managerB.Watch("config/")
+	err = managerB.ListenAndServe("127.0.0.1:9518")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, timeout := channelReadString(managerB.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on managerKVB, but got timeout")
+	}
+
+	select {
+	case event := <-events:
+		if event.Key != "config/a" && event.Key != "config/b" {
+			t.Errorf("expected watch event for config/a or config/b on managerKVB, but got:%s", event.Key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Errorf("expected watch event on managerKVB, but got timeout")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if value, ok := managerB.Get("config/a"); !ok || string(value) != "value a" {
+		t.Errorf("expected config/a on managerKVB to be 'value a', but got:%s", value)
+	}
+
+	if _, ok := managerB.Get("config/b"); ok {
+		t.Errorf("expected config/b on managerKVB to be deleted")
+	}
+
+	// writes while connected are replicated
+	managerB.Put("config/a", []byte("updated"))
+	time.Sleep(500 * time.Millisecond)
+	if value, ok := managerA.Get("config/a"); !ok || string(value) != "updated" {
+		t.Errorf("expected config/a on managerKVA to be 'updated', but got:%s", value)
+	}
+
+	logs := channelReadStrings(managerA.Log, 1)
+	if DebugLog == 1 || t.Failed() {
+		for _, log := range logs {
+			t.Log("== LOG managerKVA: ", log)
+		}
+	}
+
+	managerA.Shutdown(context.Background())
+	managerB.Shutdown(context.Background())
+}
@@ -0,0 +1,113 @@
+package cluster
+
+// Leader election follows the bully algorithm: of all nodes we are connected
+// to (including ourselves), the node with the highest name is the leader. The
+// winning node announces itself to the cluster, and any node that outranks a
+// claiming node answers with a claim of its own. A leader is only elected
+// while we have quorum.
+
+// Leader returns the name of the current cluster leader, or an empty string if there is none
+func (m *Manager) Leader() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.leader
+}
+
+// IsLeader returns true if this node is the current cluster leader
+func (m *Manager) IsLeader() bool {
+	return m.Leader() == m.name
+}
+
+// leaderCandidate returns the highest ranking node we are connected to, including ourselves
+// Draining nodes are only a candidate if all nodes are draining
+func (m *Manager) leaderCandidate() string {
+	candidate, drainingCandidate := "", ""
+	if m.IsDraining() {
+		drainingCandidate = m.name
+	} else {
+		candidate = m.name
+	}
+
+	for _, name := range m.connectedNodes.nodeNames() {
+		if m.connectedNodes.getStatus(name) == StatusDraining {
+			if name > drainingCandidate {
+				drainingCandidate = name
+			}
+			continue
+		}
+
+		if name > candidate {
+			candidate = name
+		}
+	}
+
+	if candidate == "" {
+		return drainingCandidate
+	}
+	return candidate
+}
+
+// electLeader re-evaluates the leader after a change in cluster membership
+func (m *Manager) electLeader() {
+	if !m.quorum() {
+		m.setLeader("")
+		return
+	}
+
+	candidate := m.leaderCandidate()
+	if candidate == m.name {
+		m.claimLeadership()
+		return
+	}
+
+	// the current leader is gone, wait for the candidate to claim leadership.
+	// if we are the leader, we remain so until the candidate claims it
+	leader := m.Leader()
+	if leader != "" && leader != m.name && !m.connectedNodes.nodeExists(leader) {
+		m.setLeader("")
+	}
+}
+
+// claimLeadership makes us the leader and announces it to the cluster
+func (m *Manager) claimLeadership() {
+	m.setLeader(m.name)
+	m.log("%s Claiming cluster leadership", m.name)
+	err := m.writeCluster(packetLeader{Leader: m.name})
+	if err != nil {
+		m.log("%s Failed to announce leadership to the cluster. error: %s", m.name, err)
+	}
+}
+
+// handleLeaderClaim processes a leadership claim of a remote node
+func (m *Manager) handleLeaderClaim(node, leader string) {
+	if !m.quorum() {
+		m.log("%s Ignoring leadership claim of %s, we have no quorum", m.name, leader)
+		return
+	}
+
+	if leader < m.name && !m.IsDraining() {
+		// we outrank the claiming node, bully it by claiming leadership ourselves
+		m.log("%s Rejecting leadership claim of %s, we outrank it", m.name, leader)
+		m.claimLeadership()
+		return
+	}
+
+	m.setLeader(leader)
+}
+
+// setLeader updates the leader, and informs the client application if it changed
+func (m *Manager) setLeader(leader string) {
+	m.mu.Lock()
+	if m.leader == leader {
+		m.mu.Unlock()
+		return
+	}
+	m.leader = leader
+	m.mu.Unlock()
+
+	m.log("%s Cluster leader changed to: %q", m.name, leader)
+	select {
+	case m.LeaderChange <- leader: // leader update to client application
+	default:
+	}
+}
@@ -0,0 +1,72 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestLeaderElection(t *testing.T) {
+	t.Parallel()
+
+	managerA := NewManager("managerLeaderA", "secret")
+	managerA.AddNode("managerLeaderB", "127.0.0.1:9512")
+	err := managerA.ListenAndServe("127.0.0.1:9511")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// a 2 node cluster always has quorum, so we should be our own leader until the other node joins
+	leader, timeout := channelReadString(managerA.LeaderChange, 2)
+	if timeout {
+		t.Errorf("expected LeaderChange on managerLeaderA, but got timeout")
+	}
+
+	if leader != "managerLeaderA" || !managerA.IsLeader() {
+		t.Errorf("expected managerLeaderA to be its own leader, but got:%s", leader)
+	}
+
+	managerB := NewManager("managerLeaderB", "secret")
+	managerB.AddNode("managerLeaderA", "127.0.0.1:9511")
+	err = managerB.ListenAndServe("127.0.0.1:9512")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// managerLeaderB outranks managerLeaderA, and should become leader on both nodes
+	leader, timeout = channelReadString(managerA.LeaderChange, 5)
+	if timeout {
+		t.Errorf("expected LeaderChange on managerLeaderA, but got timeout")
+	}
+
+	if leader != "managerLeaderB" {
+		t.Errorf("expected managerLeaderB to be the leader on managerLeaderA, but got:%s", leader)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if !managerB.IsLeader() || managerA.IsLeader() {
+		t.Errorf("expected managerLeaderB to be leader, but got managerLeaderA:%s managerLeaderB:%s", managerA.Leader(), managerB.Leader())
+	}
+
+	managerB.Shutdown(context.Background())
+
+	// managerLeaderA is the only node left, and should take over the leadership
+	leader, timeout = channelReadString(managerA.LeaderChange, 5)
+	if timeout {
+		t.Errorf("expected LeaderChange on managerLeaderA, but got timeout")
+	}
+
+	if leader != "managerLeaderA" {
+		t.Errorf("expected managerLeaderA to take over leadership, but got:%s", leader)
+	}
+
+	logs := channelReadStrings(managerA.Log, 1)
+	if DebugLog == 1 || t.Failed() {
+		for _, log := range logs {
+			t.Log("== LOG managerLeaderA: ", log)
+		}
+	}
+
+	managerA.Shutdown(context.Background())
+}
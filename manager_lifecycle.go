@@ -0,0 +1,131 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+)
+
+// lifecycle states of a Manager
+const (
+	stateNew     = iota // created, not listening yet
+	stateStarted        // listening and connected to the cluster
+	stateStopped        // shut down, the manager can not be started again
+)
+
+// spawn runs f in a goroutine, Shutdown waits for it to return
+func (m *Manager) spawn(f func()) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		f()
+	}()
+}
+
+// setStarted moves the manager to the started state, it fails if the manager was started before
+func (m *Manager) setStarted() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch m.state {
+	case stateStarted:
+		return fmt.Errorf("cluster node %s is already started", m.name)
+	case stateStopped:
+		return fmt.Errorf("cluster node %s was shut down, create a new manager to start it again", m.name)
+	}
+
+	m.state = stateStarted
+	return nil
+}
+
+// Run blocks until ctx is done, and then shuts down the cluster node, waiting at most the ShutdownTimeout setting
+// The cluster node must be started first with one of the ListenAndServe functions. Run returns when the node is
+// shut down by Shutdown as well.
+func (m *Manager) Run(ctx context.Context) error {
+	m.mu.Lock()
+	if m.state != stateStarted {
+		m.mu.Unlock()
+		return fmt.Errorf("cluster node %s is not started", m.name)
+	}
+
+	if m.running {
+		m.mu.Unlock()
+		return fmt.Errorf("cluster node %s is already running", m.name)
+	}
+	m.running = true
+	m.mu.Unlock()
+
+	select {
+	case <-m.quit:
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.getDuration("shutdowntimeout"))
+	defer cancel()
+	return m.Shutdown(shutdownCtx)
+}
+
+// Shutdown stops the cluster node
+// Messages still queued on ToCluster, ToClusterReliable and ToNode are sent first, then all connections are
+// closed, and Shutdown waits for all goroutines of the cluster node to exit until ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	switch m.state {
+	case stateNew:
+		m.mu.Unlock()
+		return fmt.Errorf("cluster node %s is not started", m.name)
+	case stateStopped:
+		m.mu.Unlock()
+		return fmt.Errorf("cluster node %s is already shut down", m.name)
+	}
+	m.state = stateStopped
+	m.mu.Unlock()
+
+	m.log("%s Stopping listener on %s", m.name, m.listener.Addr())
+	close(m.quit)
+	// wait for the packet manager to send the queued messages
+	select {
+	case <-m.packetsDone:
+	case <-ctx.Done():
+	}
+
+	// write exit message to remote cluster
+	m.connectedNodes.writeAll(m.packetFor(&packetNodeShutdown{}))
+	// close all connected nodes
+	m.connectedNodes.closeAll()
+	m.listener.Close()
+	removeManager(m.name)
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown of cluster node %s did not complete: %s", m.name, ctx.Err())
+	}
+}
+
+// drainQueues sends the messages still queued by the client application
+func (m *Manager) drainQueues() {
+	for {
+		var err error
+		select {
+		case pm := <-m.ToNode:
+			err = m.writeClusterNode(pm.Node, pm.Message)
+		case message := <-m.ToCluster:
+			err = m.writeCluster(message)
+		case message := <-m.ToClusterReliable:
+			err = m.writeClusterReliable(message)
+		default:
+			return
+		}
+
+		if err != nil {
+			m.log("%s Failed to write queued message during shutdown. error: %s", m.name, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerLifecycleA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerLifecycleB", "lifecycleB")
+	if err := managerA.Shutdown(context.Background()); err == nil {
+		t.Errorf("expected shutdown of a manager that was not started to fail")
+	}
+
+	if err := managerA.ListenAndServeTransport("lifecycleA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+
+	if err := managerA.ListenAndServeTransport("lifecycleA", network); err == nil {
+		t.Errorf("expected second listen to fail")
+	}
+
+	managerB := NewManager("managerLifecycleB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerLifecycleA", "lifecycleA")
+	if err := managerB.ListenAndServeTransport("lifecycleB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on managerLifecycleA, but got timeout")
+	}
+
+	// messages queued before the shutdown are sent
+	managerA.ToCluster <- "queued"
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := managerA.Shutdown(ctx); err != nil {
+		t.Fatalf("expected all goroutines to exit, but got:%s", err)
+	}
+
+	packet, timeout := channelReadPacket(managerB.FromCluster, 2)
+	var message string
+	if timeout || packet.Message(&message) != nil || message != "queued" {
+		t.Errorf("expected queued message on managerLifecycleB, but got:%+v (timeout:%t)", packet, timeout)
+	}
+
+	if err := managerA.Shutdown(ctx); err == nil {
+		t.Errorf("expected second shutdown to fail")
+	}
+
+	if err := managerA.ListenAndServeTransport("lifecycleA", network); err == nil {
+		t.Errorf("expected listen after shutdown to fail")
+	}
+
+	// a new manager can take its place
+	managerA = NewManager("managerLifecycleA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerLifecycleB", "lifecycleB")
+	if err := managerA.ListenAndServeTransport("lifecycleA", network); err != nil {
+		t.Fatalf("expected listen after restart to work, but got:%s", err)
+	}
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on the restarted managerLifecycleA, but got timeout")
+	}
+
+	// Run shuts down the manager once its context is done
+	runCtx, stop := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- managerA.Run(runCtx)
+	}()
+
+	if !waitFor(time.Second, func() bool {
+		managerA.mu.RLock()
+		defer managerA.mu.RUnlock()
+		return managerA.running
+	}) {
+		t.Fatalf("expected Run to be running")
+	}
+
+	if err := managerA.Run(context.Background()); err == nil {
+		t.Errorf("expected second Run to fail")
+	}
+
+	stop()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected Run to shut down cleanly, but got:%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected Run to return after its context is done")
+	}
+}
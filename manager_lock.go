@@ -0,0 +1,298 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Locks are granted by the cluster leader, so they are only available while
+// the cluster has quorum. Each grant comes with a fencing token that is higher
+// than any token granted before, which resources can use to reject requests of
+// a previous holder. Locks of a node are released when its connection to the
+// leader drops, or when the lease is not renewed within its ttl.
+//
+// The leader replicates every change of a lock through the key/value store,
+// under lockKeyPrefix. All nodes keep a copy of the lock table, so a new leader
+// continues with the leases and fencing tokens granted by the previous one.
+
+var (
+	// LockRetryInterval is how often Lock retries to acquire a lock held by another node
+	LockRetryInterval = 250 * time.Millisecond
+)
+
+// lockKeyPrefix is the prefix of the keys in the key/value store holding the replicated locks
+const lockKeyPrefix = "cluster.lock."
+
+// Lease is a lock held in the cluster
+type Lease struct {
+	Name    string    // name of the lock
+	Token   uint64    // fencing token of this grant
+	Expires time.Time // time the lease expires if not renewed
+	manager *Manager
+}
+
+// heldLock is a lock granted by the leader
+type heldLock struct {
+	node    string
+	token   uint64
+	expires time.Time
+}
+
+// lockEntry is a lock as replicated through the key/value store
+type lockEntry struct {
+	Node    string    `json:"node"`
+	Token   uint64    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+type lockTable struct {
+	sync.Mutex
+	writing sync.Mutex // serializes changes with their replication, so replicas are updated in order
+	token   uint64     // highest fencing token granted, by us or a previous leader
+	locks   map[string]heldLock
+}
+
+func newLockTable() *lockTable {
+	l := &lockTable{
+		locks: make(map[string]heldLock),
+	}
+	return l
+}
+
+// nextToken returns a new fencing token, higher than all tokens granted and replicated before
+// The time is only a lower bound, so tokens also increase when the whole cluster restarted
+func (l *lockTable) nextToken() uint64 {
+	l.token++
+	if now := uint64(time.Now().UnixNano()); now > l.token {
+		l.token = now
+	}
+
+	return l.token
+}
+
+// handle processes a lock request of node
+func (l *lockTable) handle(node string, request packetLockRequest) (packetLockResponse, error) {
+	l.Lock()
+	defer l.Unlock()
+	held, isHeld := l.locks[request.Name]
+	if isHeld && time.Now().After(held.expires) {
+		delete(l.locks, request.Name)
+		isHeld = false
+	}
+
+	if (request.Action == "lock" || request.Action == "renew") && request.TTL <= 0 {
+		return packetLockResponse{}, fmt.Errorf("invalid ttl %v for lock %s, it must be positive", request.TTL, request.Name)
+	}
+
+	switch request.Action {
+	case "lock":
+		if isHeld && held.node != node {
+			return packetLockResponse{Granted: false, Holder: held.node}, nil
+		}
+
+		token := l.nextToken()
+		l.locks[request.Name] = heldLock{node: node, token: token, expires: time.Now().Add(request.TTL)}
+		return packetLockResponse{Granted: true, Token: token}, nil
+
+	case "renew":
+		if !isHeld || held.node != node || held.token != request.Token {
+			return packetLockResponse{}, fmt.Errorf("lease of lock %s was lost", request.Name)
+		}
+
+		held.expires = time.Now().Add(request.TTL)
+		l.locks[request.Name] = held
+		return packetLockResponse{Granted: true, Token: held.token}, nil
+
+	case "unlock":
+		if isHeld && held.node == node && held.token == request.Token {
+			delete(l.locks, request.Name)
+		}
+		return packetLockResponse{}, nil
+	}
+
+	return packetLockResponse{}, fmt.Errorf("unknown lock action: %s", request.Action)
+}
+
+// releaseNode releases all locks held by node
+func (l *lockTable) releaseNode(node string) (released []string) {
+	l.Lock()
+	defer l.Unlock()
+	for name, held := range l.locks {
+		if held.node == node {
+			delete(l.locks, name)
+			released = append(released, name)
+		}
+	}
+
+	return
+}
+
+// entry returns the lock name as replicated through the key/value store, and false if it is not held
+func (l *lockTable) entry(name string) (lockEntry, bool) {
+	l.Lock()
+	defer l.Unlock()
+	held, ok := l.locks[name]
+	return lockEntry{Node: held.node, Token: held.token, Expires: held.expires}, ok
+}
+
+// replica applies a lock replicated by the leader
+func (l *lockTable) replica(name string, entry lockEntry, deleted bool) {
+	l.Lock()
+	defer l.Unlock()
+	if entry.Token > l.token {
+		l.token = entry.Token
+	}
+
+	if deleted {
+		delete(l.locks, name)
+		return
+	}
+
+	l.locks[name] = heldLock{node: entry.Node, token: entry.Token, expires: entry.Expires}
+}
+
+// Lock acquires the lock name for ttl, waiting until it is available or ctx is done
+// The lease has to be renewed within ttl to keep the lock
+func (m *Manager) Lock(ctx context.Context, name string, ttl time.Duration) (*Lease, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl %v for lock %s, it must be positive", ttl, name)
+	}
+
+	for {
+		start := time.Now()
+		response, err := m.lockRequest(ctx, packetLockRequest{Action: "lock", Name: name, TTL: ttl})
+		if err != nil {
+			return nil, err
+		}
+
+		if response.Granted {
+			return &Lease{Name: name, Token: response.Token, Expires: start.Add(ttl), manager: m}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock %s is held by %s: %s", name, response.Holder, ctx.Err())
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+// Renew extends the lease by ttl, it returns an error if the lease was lost
+func (l *Lease) Renew(ctx context.Context, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("invalid ttl %v for lock %s, it must be positive", ttl, l.Name)
+	}
+
+	start := time.Now()
+	_, err := l.manager.lockRequest(ctx, packetLockRequest{Action: "renew", Name: l.Name, Token: l.Token, TTL: ttl})
+	if err != nil {
+		return err
+	}
+
+	l.Expires = start.Add(ttl)
+	return nil
+}
+
+// Unlock releases the lock
+func (l *Lease) Unlock(ctx context.Context) error {
+	_, err := l.manager.lockRequest(ctx, packetLockRequest{Action: "unlock", Name: l.Name, Token: l.Token})
+	return err
+}
+
+// lockRequest sends a lock request to the leader
+func (m *Manager) lockRequest(ctx context.Context, request packetLockRequest) (packetLockResponse, error) {
+	if !m.quorum() {
+		return packetLockResponse{}, fmt.Errorf("unable to %s %s: no quorum", request.Action, request.Name)
+	}
+
+	leader := m.Leader()
+	switch leader {
+	case "":
+		return packetLockResponse{}, fmt.Errorf("unable to %s %s: no leader", request.Action, request.Name)
+
+	case m.name:
+		return m.handleLock(m.name, request)
+	}
+
+	response := packetLockResponse{}
+	err := m.Call(ctx, leader, request, &response)
+	return response, err
+}
+
+// handleLockRequest handles lock requests of other nodes while we are the leader
+func (m *Manager) handleLockRequest(packet Packet) (interface{}, error) {
+	if !m.IsLeader() || !m.quorum() {
+		return nil, fmt.Errorf("%s is not the leader", m.name)
+	}
+
+	request := packetLockRequest{}
+	err := packet.Message(&request)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.handleLock(packet.Name, request)
+}
+
+// handleLock processes a lock request while we are the leader, and replicates the change
+func (m *Manager) handleLock(node string, request packetLockRequest) (packetLockResponse, error) {
+	m.locks.writing.Lock()
+	defer m.locks.writing.Unlock()
+	response, err := m.locks.handle(node, request)
+	if err == nil {
+		m.replicateLock(request.Name)
+	}
+
+	return response, err
+}
+
+// releaseLocks releases the locks of a node that left while we are the leader
+func (m *Manager) releaseLocks(node string) {
+	if !m.IsLeader() {
+		return // the leader replicates the release
+	}
+
+	m.locks.writing.Lock()
+	defer m.locks.writing.Unlock()
+	for _, name := range m.locks.releaseNode(node) {
+		m.log("%s Released lock %s of %s", m.name, name, node)
+		m.replicateLock(name)
+	}
+}
+
+// replicateLock sends the state of lock name to the cluster through the key/value store
+func (m *Manager) replicateLock(name string) {
+	entry, held := m.locks.entry(name)
+	if !held {
+		if err := m.writeKV(kvEntry{Key: lockKeyPrefix + name, Deleted: true}); err != nil {
+			m.log("%s Failed to replicate release of lock %s. error: %s", m.name, name, err)
+		}
+		return
+	}
+
+	value, _ := json.Marshal(entry)
+	if err := m.writeKV(kvEntry{Key: lockKeyPrefix + name, Value: value}); err != nil {
+		m.log("%s Failed to replicate lock %s. error: %s", m.name, name, err)
+	}
+}
+
+// applyLock updates our copy of the lock table with a lock replicated by the leader
+func (m *Manager) applyLock(entry kvEntry) {
+	if !strings.HasPrefix(entry.Key, lockKeyPrefix) {
+		return
+	}
+
+	lock := lockEntry{}
+	if !entry.Deleted {
+		if err := json.Unmarshal(entry.Value, &lock); err != nil {
+			m.log("%s Unable to decode replicated lock %s: %s", m.name, entry.Key, err)
+			return
+		}
+	}
+
+	m.locks.replica(strings.TrimPrefix(entry.Key, lockKeyPrefix), lock, entry.Deleted)
+}
@@ -0,0 +1,182 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerLock", 2)
+	managerA, managerB := managers[0], managers[1]
+
+	if !waitFor(5*time.Second, func() bool { return managerA.Leader() == "managerLock1" }) {
+		t.Fatalf("expected managerLock1 to become leader, but got:%q", managerA.Leader())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// lock through the leader
+	leaseA, err := managerA.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock on managerLock0, but got error:%s", err)
+	}
+
+	// lock is held by managerLock0
+	short, cancelShort := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	_, err = managerB.Lock(short, "job", time.Minute)
+	cancelShort()
+	if err == nil {
+		t.Errorf("expected lock on managerLock1 to fail while held by managerLock0")
+	}
+
+	if err := leaseA.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("expected renew on managerLock0 to succeed, but got error:%s", err)
+	}
+
+	if err := leaseA.Unlock(ctx); err != nil {
+		t.Errorf("expected unlock on managerLock0 to succeed, but got error:%s", err)
+	}
+
+	leaseB, err := managerB.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock on managerLock1 after unlock, but got error:%s", err)
+	}
+
+	if leaseB.Token <= leaseA.Token {
+		t.Errorf("expected fencing token to increase, but got:%d after %d", leaseB.Token, leaseA.Token)
+	}
+
+	if err := leaseA.Renew(ctx, time.Minute); err == nil {
+		t.Errorf("expected renew of released lease to fail")
+	}
+
+	leaseB.Unlock(ctx)
+
+	// locks of a node are released when it leaves
+	leaseA, err = managerA.Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock on managerLock0, but got error:%s", err)
+	}
+
+	managerA.Shutdown(context.Background())
+	if _, timeout := channelReadString(managerB.NodeLeave, 5); timeout {
+		t.Fatalf("expected Leave on managerLock1, but got timeout")
+	}
+
+	// the lock of managerLock0 was released, so it is granted immediately
+	short, cancelShort = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if _, err := managerB.Lock(short, "job", time.Minute); err != nil {
+		t.Errorf("expected lock of managerLock0 to be released after it left, but got error:%s", err)
+	}
+}
+
+func TestLockTableExpire(t *testing.T) {
+	locks := newLockTable()
+	response, err := locks.handle("node1", packetLockRequest{Action: "lock", Name: "job", TTL: time.Millisecond})
+	if err != nil || !response.Granted {
+		t.Fatalf("expected lock to be granted, but got:%+v %v", response, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	next, err := locks.handle("node2", packetLockRequest{Action: "lock", Name: "job", TTL: time.Minute})
+	if err != nil || !next.Granted {
+		t.Fatalf("expected expired lock to be granted, but got:%+v %v", next, err)
+	}
+
+	if next.Token <= response.Token {
+		t.Errorf("expected fencing token to increase, but got:%d after %d", next.Token, response.Token)
+	}
+
+	if _, err := locks.handle("node1", packetLockRequest{Action: "renew", Name: "job", Token: response.Token, TTL: time.Minute}); err == nil {
+		t.Errorf("expected renew of expired lease to fail")
+	}
+}
+
+func TestLockTableReplica(t *testing.T) {
+	locks := newLockTable()
+
+	// a previous leader granted a token beyond our clock
+	previous := uint64(time.Now().Add(time.Hour).UnixNano())
+	locks.replica("job", lockEntry{Node: "node1", Token: previous, Expires: time.Now().Add(time.Minute)}, false)
+
+	if _, err := locks.handle("node1", packetLockRequest{Action: "renew", Name: "job", Token: previous, TTL: time.Minute}); err != nil {
+		t.Errorf("expected renew of a replicated lease to succeed, but got:%s", err)
+	}
+
+	response, err := locks.handle("node2", packetLockRequest{Action: "lock", Name: "other", TTL: time.Minute})
+	if err != nil || !response.Granted {
+		t.Fatalf("expected lock to be granted, but got:%+v %v", response, err)
+	}
+
+	if response.Token <= previous {
+		t.Errorf("expected fencing token to continue after %d, but got:%d", previous, response.Token)
+	}
+
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		if _, err := locks.handle("node2", packetLockRequest{Action: "lock", Name: "ttl", TTL: ttl}); err == nil {
+			t.Errorf("expected lock with ttl %v to fail", ttl)
+		}
+	}
+}
+
+func TestLockFailover(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerLockFailover", 3)
+
+	leaderIs := func(leader string) func() bool {
+		return func() bool { return managers[0].Leader() == leader && managers[1].Leader() == leader }
+	}
+	if !waitFor(5*time.Second, leaderIs("managerLockFailover2")) {
+		t.Fatalf("expected managerLockFailover2 to become leader")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	lease, err := managers[0].Lock(ctx, "job", time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock on managerLockFailover0, but got error:%s", err)
+	}
+
+	if _, err := managers[0].Lock(ctx, "zero", 0); err == nil {
+		t.Errorf("expected lock without ttl to fail")
+	}
+
+	replicated := func() bool {
+		entry, ok := managers[1].locks.entry("job")
+		return ok && entry.Token == lease.Token
+	}
+	if !waitFor(5*time.Second, replicated) {
+		t.Fatalf("expected lock to be replicated to managerLockFailover1")
+	}
+
+	// the leader fails, the new leader continues with its leases and tokens
+	managers[2].Shutdown(context.Background())
+	if !waitFor(5*time.Second, leaderIs("managerLockFailover1")) {
+		t.Fatalf("expected managerLockFailover1 to take over the leadership")
+	}
+
+	if err := lease.Renew(ctx, time.Minute); err != nil {
+		t.Errorf("expected lease to survive the change of leader, but got:%s", err)
+	}
+
+	short, cancelShort := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancelShort()
+	if _, err := managers[1].Lock(short, "job", time.Minute); err == nil {
+		t.Errorf("expected lock to still be held by managerLockFailover0")
+	}
+
+	other, err := managers[1].Lock(ctx, "other", time.Minute)
+	if err != nil {
+		t.Fatalf("expected lock on managerLockFailover1, but got error:%s", err)
+	}
+
+	if other.Token <= lease.Token {
+		t.Errorf("expected fencing token to increase after a change of leader, but got:%d after %d", other.Token, lease.Token)
+	}
+}
@@ -1,12 +1,210 @@
 package cluster
 
 import (
-	"crypto/tls"
-	"net"
+	"math/rand"
+	"sync"
 	"time"
 )
 
-func (m *Manager) handleOutgoingConnections(tlsConfig *tls.Config) {
+// Each node we are not connected to gets its own dialer, so an unreachable
+// node does not delay the connections to the others. After a failed attempt
+// the dialer waits Settings.ConnectInterval, doubling for each next failure
+// up to Settings.MaxBackoff, with a random jitter so the cluster does
+// not reconnect to a recovering node all at the same moment.
+//
+// An admin can put a node down for a while, which disconnects it, and stops
+// both our dialer and the node itself from reconnecting until it expires.
+
+// Connection states of a node, as shown in the cluster API
+const (
+	// ConnectIdle is the state of a node we are not trying to connect to
+	ConnectIdle = "idle"
+	// ConnectDialing is the state of a node we are connecting to
+	ConnectDialing = "dialing"
+	// ConnectBackoff is the state of a node we failed to connect to, waiting for the next attempt
+	ConnectBackoff = "backoff"
+	// ConnectAuthenticating is the state of a node we connected to, and are authenticating with
+	ConnectAuthenticating = "authenticating"
+	// ConnectOnline is the state of a node we are connected to
+	ConnectOnline = "online"
+	// ConnectAdminDown is the state of a node an admin put down, we do not connect to it until it expires
+	ConnectAdminDown = "admindown"
+)
+
+// dialerPool keeps the connection state of each configured node
+type dialerPool struct {
+	sync.Mutex
+	dialers map[string]*dialer
+	scan    chan struct{} // wakes up the check for nodes without a dialer
+}
+
+// dialer is the connection state of a single node
+type dialer struct {
+	state    string    // one of the Connect states
+	attempts int       // failed connection attempts since we were last connected
+	retry    time.Time // time of the next attempt while in backoff
+	running  bool      // wether a goroutine is dialing the node
+	down     time.Time // connections are refused until this time, set by an admin
+	wake     chan struct{}
+}
+
+func newDialerPool() *dialerPool {
+	p := &dialerPool{
+		dialers: make(map[string]*dialer),
+		scan:    make(chan struct{}, 1),
+	}
+	return p
+}
+
+func (p *dialerPool) get(node string) *dialer {
+	d, ok := p.dialers[node]
+	if !ok {
+		d = &dialer{state: ConnectIdle, wake: make(chan struct{}, 1)}
+		p.dialers[node] = d
+	}
+	return d
+}
+
+// start marks a dialer of node as running, returns false if one is running already
+func (p *dialerPool) start(node string) bool {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	if d.running {
+		return false
+	}
+
+	d.running = true
+	return true
+}
+
+// stop marks the dialer of node as exited
+func (p *dialerPool) stop(node, state string) {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	d.running = false
+	d.state = state
+	d.retry = time.Time{}
+}
+
+func (p *dialerPool) setState(node, state string, retry time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	d.state = state
+	d.retry = retry
+}
+
+// failed records a failed attempt, returns the number of failed attempts since we were last connected
+func (p *dialerPool) failed(node string) int {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	d.attempts++
+	return d.attempts
+}
+
+// connected marks a node as online, regardless of which side made the connection
+func (p *dialerPool) connected(node string) {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	d.attempts = 0
+	if !d.running {
+		d.state = ConnectOnline
+		d.retry = time.Time{}
+	}
+}
+
+// disconnected marks a node as idle if we are not dialing it
+func (p *dialerPool) disconnected(node string) {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	if !d.running {
+		d.state = ConnectIdle
+	}
+}
+
+// getState returns the connection state of a node, and the time of the next attempt while in backoff
+func (p *dialerPool) getState(node string) (string, time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	if d, ok := p.dialers[node]; ok {
+		return d.state, d.retry
+	}
+
+	return ConnectIdle, time.Time{}
+}
+
+// wakeChan returns the channel waking up the dialer of node while it waits
+func (p *dialerPool) wakeChan(node string) chan struct{} {
+	p.Lock()
+	defer p.Unlock()
+	return p.get(node).wake
+}
+
+// retry resets the backoff of node, and dials it right away
+func (p *dialerPool) retry(node string) {
+	p.Lock()
+	defer p.Unlock()
+	d := p.get(node)
+	d.attempts = 0
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	select {
+	case p.scan <- struct{}{}:
+	default:
+	}
+}
+
+// setAdminDown refuses connections to and from node until the given time, a zero time clears it
+func (p *dialerPool) setAdminDown(node string, until time.Time) {
+	p.Lock()
+	defer p.Unlock()
+	p.get(node).down = until
+}
+
+// adminDown returns until when connections to and from node are refused, or a zero time if they are not
+func (p *dialerPool) adminDown(node string) time.Time {
+	p.Lock()
+	defer p.Unlock()
+	d, ok := p.dialers[node]
+	if !ok || time.Now().After(d.down) {
+		return time.Time{}
+	}
+
+	return d.down
+}
+
+func (p *dialerPool) remove(node string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.dialers, node)
+}
+
+// connectBackoff returns how long to wait after a number of failed attempts, with jitter
+func connectBackoff(interval, max time.Duration, attempts int) time.Duration {
+	if max < interval {
+		max = interval
+	}
+
+	delay := interval
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+
+	// wait at least half of the delay, and a random part of the other half
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func (m *Manager) handleOutgoingConnections() {
 	for {
 		select {
 		case <-m.quit:
@@ -16,60 +214,102 @@ func (m *Manager) handleOutgoingConnections(tlsConfig *tls.Config) {
 		default:
 		}
 
-		// Attempt to connect to non-connected nodes
+		// Start a dialer for each non-connected node
 		for _, node := range m.getConfiguredNodes() {
-			if !m.connectedNodes.nodeExists(node.name) {
-				// Connect to the remote cluster node
-				m.log("%s Connecting to non-connected cluster node: %s", m.name, node.name)
-				m.dial(node.name, node.addr, tlsConfig)
+			if m.connectedNodes.nodeExists(node.name) {
+				m.dialers.connected(node.name)
+				continue
+			}
+
+			m.dialers.disconnected(node.name)
+			if m.dialers.start(node.name) {
+				name := node.name
+				m.spawn(func() {
+					m.dialNode(name)
+				})
 			}
 		}
-		//w ait before we try again
-		time.Sleep(m.getDuration("connectinterval"))
-	}
-}
-
-func (m *Manager) dial(name, addr string, tlsConfig *tls.Config) {
-	var conn net.Conn
-	var err error
-	if len(tlsConfig.Certificates) == 0 {
-		m.log("%s Connecting to %s (%s) non-tls", m.name, name, addr)
-		conn, err = net.DialTimeout("tcp", addr, m.getDuration("connecttimeout"))
-	} else {
-		m.log("%s Connecting to %s (%s) with-tls", m.name, name, addr)
-		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: m.getDuration("connecttimeout")}, "tcp", addr, tlsConfig)
-	}
-
-	if err == nil {
-		// on dialing out, we need to send an auth
-		authRequest, _ := m.newPacket(packetAuthRequest{AuthKey: m.authKey})
-		m.connectedNodes.writeSocket(conn, authRequest)
-		packet, err := m.connectedNodes.readSocket(conn)
-		if err != nil {
-			// close connection if someone is talking gibrish
-			m.log("%s auth request failed on dial: %s", m.name, err)
-			conn.Close()
+		// wait before we check again
+		select {
+		case <-m.quit:
+		case <-m.dialers.scan:
+		case <-time.After(m.getDuration("connectinterval")):
+		}
+	}
+}
+
+// dialNode connects to a node until it succeeds, the node is removed, or the manager shuts down
+func (m *Manager) dialNode(name string) {
+	wake := m.dialers.wakeChan(name)
+	for {
+		addr, ok := m.configuredAddr(name)
+		if !ok {
+			m.dialers.remove(name)
 			return
 		}
 
-		authResponse := &packetAuthResponse{}
-		err = packet.Message(authResponse)
-		if err != nil {
-			// auth response unknown
-			m.log("%s auth response failed on dial: %s", m.name, err)
-			conn.Close()
+		if m.connectedNodes.nodeExists(name) {
+			m.dialers.stop(name, ConnectOnline)
 			return
 		}
 
-		if authResponse.Status != true {
-			m.log("%s auth failed on dial: %s", m.name, authResponse.Error)
-			conn.Close()
+		if until := m.dialers.adminDown(name); !until.IsZero() {
+			m.dialers.setState(name, ConnectAdminDown, until)
+			select {
+			case <-m.quit:
+				m.dialers.stop(name, ConnectIdle)
+				return
+			case <-wake:
+			case <-time.After(time.Until(until)):
+			}
+			continue
+		}
+
+		m.log("%s Connecting to non-connected cluster node: %s", m.name, name)
+		err := m.dial(name, addr)
+		if err == nil {
+			m.dialers.connected(name)
+			m.dialers.stop(name, ConnectOnline)
 			return
 		}
 
-		m.log("%s Connection to %s (%s) authorized", m.name, name, addr)
-		node := newNode(packet.Name, conn, false)
+		attempts := m.dialers.failed(name)
+		delay := connectBackoff(m.getDuration("connectinterval"), m.getDuration("maxbackoff"), attempts)
+		m.log("%s Failed to connect to %s (attempt:%d), retrying in %v. error: %s", m.name, name, attempts, delay, err)
+		m.dialers.setState(name, ConnectBackoff, time.Now().Add(delay))
+		select {
+		case <-m.quit:
+			m.dialers.stop(name, ConnectIdle)
+			return
+		case <-wake:
+		case <-time.After(delay):
+		}
+	}
+}
 
-		go m.handleAuthorizedConnection(node)
+func (m *Manager) dial(name, addr string) error {
+	m.log("%s Connecting to %s (%s)", m.name, name, addr)
+	m.dialers.setState(name, ConnectDialing, time.Time{})
+	conn, err := m.transport.Dial(addr, m.getDuration("connecttimeout"))
+	if err != nil {
+		return err
 	}
+
+	// on dialing out, we need to authenticate
+	m.dialers.setState(name, ConnectAuthenticating, time.Time{})
+	node, err := m.authenticateOutgoing(conn)
+	if err != nil {
+		// close connection if someone is talking gibrish, or does not know our key
+		m.log("%s auth failed on dial: %s", m.name, err)
+		m.setNodeError(name, err.Error())
+		conn.Close()
+		return err
+	}
+
+	m.log("%s Connection to %s (%s) authorized", m.name, name, addr)
+
+	m.spawn(func() {
+		m.handleAuthorizedConnection(node)
+	})
+	return nil
 }
@@ -0,0 +1,92 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestConnectBackoff(t *testing.T) {
+	interval := 100 * time.Millisecond
+	max := time.Second
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{attempts: 1, delay: 100 * time.Millisecond},
+		{attempts: 2, delay: 200 * time.Millisecond},
+		{attempts: 4, delay: 800 * time.Millisecond},
+		{attempts: 5, delay: time.Second},
+		{attempts: 50, delay: time.Second},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 10; i++ {
+			delay := connectBackoff(interval, max, test.attempts)
+			if delay < test.delay/2 || delay > test.delay {
+				t.Errorf("expected backoff between %v and %v after %d attempts, but got:%v", test.delay/2, test.delay, test.attempts, delay)
+			}
+		}
+	}
+}
+
+func TestDialerBackoff(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+	settings.MaxBackoff = 400 * time.Millisecond
+
+	managerA := NewManager("managerDialerA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerDialerB", "dialerB")
+	managerA.AddNode("managerDialerC", "dialerC") // never started
+	if err := managerA.ListenAndServeTransport("dialerA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	// the unreachable node backs off
+	backoff := func() bool {
+		state, retry := managerA.dialers.getState("managerDialerC")
+		return state == ConnectBackoff && retry.After(time.Now())
+	}
+	if !waitFor(5*time.Second, backoff) {
+		state, retry := managerA.dialers.getState("managerDialerC")
+		t.Fatalf("expected managerDialerC to be in backoff, but got:%s (retry:%v)", state, retry)
+	}
+
+	managerB := NewManager("managerDialerB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerDialerA", "dialerA")
+	if err := managerB.ListenAndServeTransport("dialerB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	online := func() bool {
+		state, _ := managerA.dialers.getState("managerDialerB")
+		return state == ConnectOnline
+	}
+	if !waitFor(5*time.Second, online) {
+		state, _ := managerA.dialers.getState("managerDialerB")
+		t.Errorf("expected managerDialerB to be online, but got:%s", state)
+	}
+
+	attempts := func() bool {
+		managerA.dialers.Lock()
+		defer managerA.dialers.Unlock()
+		return managerA.dialers.dialers["managerDialerC"].attempts >= 3
+	}
+	if !waitFor(5*time.Second, attempts) {
+		t.Errorf("expected managerDialerC to be retried with backoff")
+	}
+
+	// removed nodes are no longer dialed
+	managerA.RemoveNode("managerDialerC")
+	if state, _ := managerA.dialers.getState("managerDialerC"); state != ConnectIdle {
+		t.Errorf("expected removed node to be idle, but got:%s", state)
+	}
+}
@@ -3,13 +3,17 @@ package cluster
 import (
 	"encoding/json"
 	"fmt"
-	"reflect"
 	"time"
 )
 
 func (m *Manager) handlePackets() {
+	defer close(m.packetsDone)
 	for {
 		select {
+		case <-m.quit:
+			m.drainQueues()
+			return
+
 		case pm := <-m.ToNode: // incomming from client application
 			if LogTraffic {
 				m.log("%s traffic to cluster node: %+v", m.name, pm)
@@ -30,14 +34,19 @@ func (m *Manager) handlePackets() {
 				m.log("%s Failed to write message to remote node. error: %s", m.name, err)
 			}
 
-		case message := <-m.apiRequest: // incomming messages from API
+		case message := <-m.ToClusterReliable: // incomming from client application
 			if LogTraffic {
-				m.log("%s traffic from cluster api: %+v", m.name, message)
+				m.log("%s traffic to cluster (reliable): %+v", m.name, message)
 			}
 
-			switch message.Action {
-			case "reconnect":
-			case "admin":
+			err := m.writeClusterReliable(message)
+			if err != nil {
+				m.log("%s Failed to write reliable message to remote node, it will be resent on reconnect. error: %s", m.name, err)
+			}
+
+		case message := <-m.apiRequest: // incomming messages from API
+			if LogTraffic {
+				m.log("%s traffic from cluster api: %+v", m.name, message)
 			}
 
 			m.log("%s Cluster API request: %s (%s)", m.name, message.Action, message.Node)
@@ -51,25 +60,64 @@ func (m *Manager) handlePackets() {
 			switch message.Type {
 			case "nodeadd":
 				m.updateQuorum()
+				m.electLeader()
 
 			case "noderemove":
+				m.reliable.remove(message.Node)
+				if !m.connectedNodes.nodeExists(message.Node) && m.liveness.leave(message.Node) {
+					select {
+					case m.NodeLeave <- message.Node: // send node leave to client application
+					default:
+					}
+				}
 				m.updateQuorum()
+				m.electLeader()
 
 			case "nodejoin":
 				m.log("%s Cluster node joined: %s", m.name, message.Node)
-				select {
-				case m.NodeJoin <- message.Node: // send node join to client application
-				default:
+				if m.liveness.join(message.Node) { // not reported when we reconnect to a node other nodes could still reach
+					select {
+					case m.NodeJoin <- message.Node: // send node join to client application
+					default:
+					}
 				}
 				m.updateQuorum()
+				m.electLeader()
+				m.reliable.setOnline(message.Node, true)
+				if err := m.resendReliable(message.Node); err != nil {
+					m.log("%s Failed to resend reliable messages to %s. error: %s", m.name, message.Node, err)
+				}
+				if !m.connectedNodes.hasCapability(message.Node, CapabilityReliable) {
+					m.reliable.remove(message.Node) // it will not acknowledge the packets we sent
+				}
+				m.syncKV(message.Node)
+				m.sendTopics(message.Node)
+				m.streams.resume(message.Node)
+				m.sendMembers(message.Node)
+				if m.IsDraining() {
+					m.writeClusterNode(message.Node, packetNodeDrain{})
+				}
 
-			case "nodeleave":
-				m.log("%s Cluster node left: %s (%s)", m.name, message.Node, message.Error)
-				select {
-				case m.NodeLeave <- message.Node: // send node join to client application
-				default:
+			case "nodefailed":
+				if m.connectedNodes.nodeExists(message.Node) {
+					break // reconnected while we were probing it
 				}
+				if m.liveness.leave(message.Node) {
+					m.log("%s Cluster node left: %s (%s)", m.name, message.Node, message.Error)
+					select {
+					case m.NodeLeave <- message.Node: // send node leave to client application
+					default:
+					}
+				}
+
+			case "nodeleave":
+				m.log("%s Connection to cluster node lost: %s (%s)", m.name, message.Node, message.Error)
+				m.calls.cancelNode(message.Node, fmt.Errorf("node %s left the cluster", message.Node))
+				m.reliable.setOnline(message.Node, false)
+				m.topics.removeNode(message.Node)
 				m.updateQuorum()
+				m.electLeader()
+				m.releaseLocks(message.Node) // after the election, in case the node was the leader
 			default:
 				m.log("%s Unknown internal message %+v", m.name, message)
 			}
@@ -81,6 +129,33 @@ func (m *Manager) handlePackets() {
 
 			m.connectedNodes.incPackets(packet.Name)
 
+			dataType, known := resolveType(packet.DataType)
+			packet.DataType = dataType
+
+			if packet.RequestID != "" {
+				m.handleCallPacket(packet)
+				continue
+			}
+
+			if packet.Topic != "" {
+				if full := m.topics.deliver(packet); full > 0 {
+					m.log("%s unable to deliver message on topic %s to %d subscribers, channel full!", m.name, packet.Topic, full)
+				}
+				continue
+			}
+
+			if packet.Sequence != 0 && packet.from != nil && packet.from.closed() {
+				// not acknowledged, the node resends it when it reconnects
+				m.log("%s Dropping packet %d of %s, its connection was closed", m.name, packet.Sequence, packet.Name)
+				continue
+			}
+
+			if packet.Sequence != 0 && m.reliable.duplicate(packet.Name, packet.Sequence) {
+				m.log("%s Dropping duplicate packet %d of %s", m.name, packet.Sequence, packet.Name)
+				m.queueDelivery(delivery{packet: packet, ackOnly: true}) // acknowledge after the original was delivered
+				continue
+			}
+
 			switch packet.DataType {
 			case "cluster.Auth": // internal use
 				m.connectedNodes.setStatus(packet.Name, StatusAuthenticating)
@@ -90,12 +165,128 @@ func (m *Manager) handlePackets() {
 				m.log("%s Got exit notice from node %s (shutdown)", m.name, packet.Name)
 				m.connectedNodes.close(packet.Name)
 
+			case "cluster.packetNodeDrain": // internal use
+				m.connectedNodes.setStatus(packet.Name, StatusDraining)
+				m.log("%s Got drain notice from node %s", m.name, packet.Name)
+				select {
+				case m.NodeDrain <- packet.Name: // send node drain to client application
+				default:
+				}
+				m.electLeader()
+
+			case "cluster.packetLeader": // internal use
+				leader := &packetLeader{}
+				if err := packet.Message(leader); err != nil {
+					m.log("%s Unable to decode leader claim from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.handleLeaderClaim(packet.Name, leader.Leader)
+
+			case "cluster.packetAck": // internal use
+				ack := &packetAck{}
+				if err := packet.Message(ack); err != nil {
+					m.log("%s Unable to decode acknowledgement from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.reliable.ack(packet.Name, ack.Sequence)
+
+			case "cluster.packetKVUpdate": // internal use
+				update := &packetKVUpdate{}
+				if err := packet.Message(update); err != nil {
+					m.log("%s Unable to decode key/value update from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				if m.kv.apply(update.Entry) {
+					m.applyLock(update.Entry)
+				}
+
+			case "cluster.packetKVSync": // internal use
+				state := &packetKVSync{}
+				if err := packet.Message(state); err != nil {
+					m.log("%s Unable to decode key/value sync from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				for _, entry := range state.Entries {
+					if m.kv.apply(entry) {
+						m.applyLock(entry)
+					}
+				}
+
+			case "cluster.packetMembers": // internal use
+				members := &packetMembers{}
+				if err := packet.Message(members); err != nil {
+					m.log("%s Unable to decode cluster membership from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.mergeMembers(packet.Name, members.Members)
+
+			case "cluster.packetSubscriptions": // internal use
+				subscriptions := &packetSubscriptions{}
+				if err := packet.Message(subscriptions); err != nil {
+					m.log("%s Unable to decode subscriptions from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.topics.setRemote(packet.Name, subscriptions.Topics)
+
+			case streamChunkType: // internal use
+				chunk := &packetStreamChunk{}
+				if err := packet.Message(chunk); err != nil {
+					m.log("%s Unable to decode stream chunk from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.handleStreamChunk(packet.Name, *chunk)
+
+			case "cluster.packetStreamAck": // internal use
+				ack := &packetStreamAck{}
+				if err := packet.Message(ack); err != nil {
+					m.log("%s Unable to decode stream acknowledgement from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.streams.ack(packet.Name, *ack)
+
 			case "cluster.packetPing": // internal use
-				m.log("%s Got ping from node %s (%v)", m.name, packet.Name, time.Now().Sub(packet.Time))
-				m.connectedNodes.setLag(packet.Name, time.Now().Sub(packet.Time))
+				ping := &packetPing{}
+				if err := packet.Message(ping); err != nil {
+					m.log("%s Unable to decode ping from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.log("%s Got ping from node %s", m.name, packet.Name)
+				m.connectedNodes.heartbeat(packet.Name, packet.receivedAt())
+				m.handlePing(packet.Name, *ping, packet.receivedAt())
+
+			case "cluster.packetPong": // internal use
+				pong := &packetPong{}
+				if err := packet.Message(pong); err != nil {
+					m.log("%s Unable to decode pong from %s: %s", m.name, packet.Name, err)
+					continue
+				}
+				m.handlePong(packet.Name, *pong, packet.receivedAt())
 
 			default:
-				m.log("%s Recieved non-cluster packet: %s", m.name, packet.DataType)
+				if !known {
+					if m.strictTypes() {
+						m.log("%s Dropping packet of unregistered type %s from %s", m.name, packet.DataType, packet.Name)
+						m.unknownType(packet, true)
+						break
+					}
+					m.unknownType(packet, false)
+					m.log("%s Recieved packet of unregistered type %s from %s", m.name, packet.DataType, packet.Name)
+				} else {
+					m.log("%s Recieved non-cluster packet: %s", m.name, packet.DataType)
+				}
+
+				if packet.Sequence != 0 {
+					// reliable packets are not dropped, they are handled or delivered and acknowledged outside of the packet manager
+					if m.queueDelivery(delivery{packet: packet}) {
+						m.reliable.receive(packet.Name, packet.Sequence)
+					}
+					continue
+				}
+
+				if m.dispatchHandler(packet) {
+					break
+				}
+
 				select {
 				case m.FromCluster <- packet: // outgoing to client application
 				default:
@@ -103,16 +294,29 @@ func (m *Manager) handlePackets() {
 				}
 
 			}
+
+			if packet.Sequence != 0 {
+				m.reliable.receive(packet.Name, packet.Sequence)
+				m.ackReliable(packet)
+			}
 		}
 	}
 }
 
 func (m *Manager) newPacket(dataMessage interface{}) ([]byte, error) {
-	val := reflect.Indirect(reflect.ValueOf(dataMessage))
+	return m.encodePacket(m.packetFor(dataMessage))
+}
+
+func (m *Manager) packetFor(dataMessage interface{}) *Packet {
 	packet := &Packet{
-		Name:     m.name,
-		DataType: fmt.Sprintf("%s", val.Type()),
-		Time:     time.Now(),
+		Name:    m.name,
+		Time:    time.Now(),
+		codec:   "json",
+		message: dataMessage,
+	}
+
+	if dataMessage != nil {
+		packet.DataType = dataTypeOf(dataMessage)
 	}
 
 	data, err := json.Marshal(dataMessage)
@@ -121,7 +325,10 @@ func (m *Manager) newPacket(dataMessage interface{}) ([]byte, error) {
 	}
 
 	packet.DataMessage = string(data)
+	return packet
+}
 
+func (m *Manager) encodePacket(packet *Packet) ([]byte, error) {
 	packetData, err := json.Marshal(packet)
 	if err != nil {
 		m.log("%s Unable to create json packet: %s", m.name, err)
@@ -0,0 +1,178 @@
+package cluster
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// When the connection to a node is lost, we do not report it as failed right
+// away, as only the link between us may be broken. Like SWIM, we first ask up
+// to IndirectProbes other connected nodes to probe it on our behalf. The node
+// is only reported on NodeLeave if none of them can reach it, otherwise it is
+// probed again every ping interval until we reconnect, it becomes unreachable,
+// or it is removed. Nodes that sent a shutdown notice are reported immediately.
+
+var (
+	// IndirectProbes is the number of nodes asked to probe a node we lost the connection to
+	IndirectProbes = 3
+)
+
+// liveness keeps the cluster wide view of the nodes, next to the connections in the connection pool
+type liveness struct {
+	sync.Mutex
+	joined   map[string]bool // nodes reported with NodeJoin, and not yet with NodeLeave
+	indirect map[string]bool // nodes we lost the connection to, which are still reachable through other nodes
+}
+
+func newLiveness() *liveness {
+	l := &liveness{
+		joined:   make(map[string]bool),
+		indirect: make(map[string]bool),
+	}
+	return l
+}
+
+// join marks a node as connected, returns true if it was not reported as joined before
+func (l *liveness) join(node string) bool {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.indirect, node)
+	if l.joined[node] {
+		return false
+	}
+
+	l.joined[node] = true
+	return true
+}
+
+// leave marks a node as failed, returns true if it was reported as joined before
+func (l *liveness) leave(node string) bool {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.indirect, node)
+	if !l.joined[node] {
+		return false
+	}
+
+	delete(l.joined, node)
+	return true
+}
+
+func (l *liveness) setIndirect(node string, indirect bool) {
+	l.Lock()
+	defer l.Unlock()
+	if indirect {
+		l.indirect[node] = true
+		return
+	}
+	delete(l.indirect, node)
+}
+
+// isIndirect returns true if we are not connected to node, but other nodes are
+func (l *liveness) isIndirect(node string) bool {
+	l.Lock()
+	defer l.Unlock()
+	return l.indirect[node]
+}
+
+// confirmFailure probes a node we lost the connection to through other nodes, and reports it as failed once none of them reach it
+func (m *Manager) confirmFailure(node, reason string, shutdown bool) {
+	for !shutdown {
+		select {
+		case <-m.quit:
+			return
+		default:
+		}
+
+		if m.connectedNodes.nodeExists(node) {
+			return // reconnected
+		}
+
+		if !m.NodeConfigured(node) {
+			break // removed, stop probing it
+		}
+
+		helper, reachable := m.probeIndirect(node)
+		if !reachable {
+			break
+		}
+
+		if !m.liveness.isIndirect(node) {
+			m.log("%s Lost connection to %s, but it is still reachable through %s", m.name, node, helper)
+			m.liveness.setIndirect(node, true)
+		}
+
+		select {
+		case <-m.quit:
+			return
+		case <-time.After(m.getDuration("pinginterval")):
+		}
+	}
+
+	m.sendInternal(internalMessage{Type: "nodefailed", Node: node, Error: reason})
+}
+
+// probeIndirect asks other connected nodes to probe node, and returns the first node that reached it
+func (m *Manager) probeIndirect(node string) (string, bool) {
+	var helpers []string
+	for _, name := range m.connectedNodes.nodeNames() {
+		if name != node {
+			helpers = append(helpers, name)
+		}
+	}
+
+	rand.Shuffle(len(helpers), func(i, j int) { helpers[i], helpers[j] = helpers[j], helpers[i] })
+	if len(helpers) > IndirectProbes {
+		helpers = helpers[:IndirectProbes]
+	}
+
+	if len(helpers) == 0 {
+		return "", false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*m.getDuration("pinginterval"))
+	defer cancel()
+	results := make(chan string, len(helpers))
+	for _, helper := range helpers {
+		go func(helper string) {
+			response := &packetProbeResponse{}
+			err := m.Call(ctx, helper, packetProbeRequest{Node: node}, response)
+			if err != nil || !response.Reachable {
+				helper = ""
+			}
+			results <- helper
+		}(helper)
+	}
+
+	for range helpers {
+		if helper := <-results; helper != "" {
+			return helper, true
+		}
+	}
+
+	return "", false
+}
+
+// handleProbeRequest probes a node on behalf of another node
+func (m *Manager) handleProbeRequest(packet Packet) (interface{}, error) {
+	request := &packetProbeRequest{}
+	if err := packet.Message(request); err != nil {
+		return nil, err
+	}
+
+	if !m.connectedNodes.nodeExists(request.Node) {
+		return packetProbeResponse{Reachable: false}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.getDuration("pinginterval"))
+	defer cancel()
+	err := m.Call(ctx, request.Node, packetProbe{}, nil)
+	return packetProbeResponse{Reachable: err == nil}, nil
+}
+
+// handleProbe answers a probe
+func (m *Manager) handleProbe(packet Packet) (interface{}, error) {
+	return packetProbe{}, nil
+}
@@ -0,0 +1,47 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProbeRemovedNode(t *testing.T) {
+	t.Parallel()
+
+	// managerProbe1 is connected to both, managerProbe0 is not connected to managerProbe2
+	managers := startMemoryCluster(t, "managerProbe", 3, func(settings *Settings) {
+		settings.PingInterval = 100 * time.Millisecond
+		settings.GossipInterval = time.Hour
+	})
+	managerA, managerB, managerC := managers[0], managers[1], managers[2]
+	managerA.AdminDown("managerProbe2", time.Hour)
+	managerC.AdminDown("managerProbe0", time.Hour)
+
+	if !waitFor(5*time.Second, func() bool {
+		return managerA.connectedNodes.nodeExists("managerProbe1") && managerB.connectedNodes.nodeExists("managerProbe2")
+	}) {
+		t.Fatalf("expected managerProbe1 to connect to both other nodes")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		managerA.confirmFailure("managerProbe2", "connection lost", false)
+		close(stopped)
+	}()
+
+	if !waitFor(5*time.Second, func() bool { return managerA.liveness.isIndirect("managerProbe2") }) {
+		t.Fatalf("expected managerProbe2 to be reachable through managerProbe1")
+	}
+
+	// a node removed on this node only is still reachable through others, but no longer probed
+	managerA.removeNode("managerProbe2")
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected probing of managerProbe2 to stop once it was removed")
+	}
+
+	if !waitFor(time.Second, func() bool { return !managerA.liveness.isIndirect("managerProbe2") }) {
+		t.Errorf("expected the liveness of managerProbe2 to be cleared once it was removed")
+	}
+}
@@ -0,0 +1,173 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Each node advertises the topics it subscribed to, to all connected nodes
+// when its subscriptions change and to nodes that join. Publish only sends a
+// message to the nodes that subscribed to its topic.
+
+type topicPool struct {
+	sync.RWMutex
+	local  map[string][]chan Packet   // channels of the client application per topic
+	remote map[string]map[string]bool // topics subscribed to per node
+}
+
+func newTopicPool() *topicPool {
+	t := &topicPool{
+		local:  make(map[string][]chan Packet),
+		remote: make(map[string]map[string]bool),
+	}
+	return t
+}
+
+// subscribe adds a channel for topic, returns true if this is the first subscription to topic
+func (t *topicPool) subscribe(topic string) (chan Packet, bool) {
+	t.Lock()
+	defer t.Unlock()
+	messages := make(chan Packet, ChannelBufferSize)
+	t.local[topic] = append(t.local[topic], messages)
+	return messages, len(t.local[topic]) == 1
+}
+
+// unsubscribe removes a channel for topic, returns true if there are no subscriptions to topic left
+func (t *topicPool) unsubscribe(topic string, messages chan Packet) bool {
+	t.Lock()
+	defer t.Unlock()
+	var channels []chan Packet
+	for _, channel := range t.local[topic] {
+		if channel != messages {
+			channels = append(channels, channel)
+		}
+	}
+
+	if len(channels) == len(t.local[topic]) {
+		return false // not subscribed
+	}
+
+	if len(channels) == 0 {
+		delete(t.local, topic)
+		return true
+	}
+
+	t.local[topic] = channels
+	return false
+}
+
+// topics returns the topics subscribed to locally
+func (t *topicPool) topics() (topics []string) {
+	t.RLock()
+	defer t.RUnlock()
+	for topic := range t.local {
+		topics = append(topics, topic)
+	}
+
+	sort.Strings(topics)
+	return
+}
+
+// setRemote replaces the topics subscribed to by node
+func (t *topicPool) setRemote(node string, topics []string) {
+	t.Lock()
+	defer t.Unlock()
+	t.remote[node] = make(map[string]bool)
+	for _, topic := range topics {
+		t.remote[node][topic] = true
+	}
+}
+
+func (t *topicPool) removeNode(node string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.remote, node)
+}
+
+// subscribers returns the nodes subscribed to topic
+func (t *topicPool) subscribers(topic string) (nodes []string) {
+	t.RLock()
+	defer t.RUnlock()
+	for node, topics := range t.remote {
+		if topics[topic] {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return
+}
+
+// deliver sends packet to all local subscribers of its topic, returns the number of channels that were full
+func (t *topicPool) deliver(packet Packet) (full int) {
+	t.RLock()
+	defer t.RUnlock()
+	for _, messages := range t.local[packet.Topic] {
+		select {
+		case messages <- packet:
+		default:
+			full++
+		}
+	}
+
+	return
+}
+
+// Subscribe returns a channel receiving all messages published to topic
+// Messages are dropped if the channel is full
+func (m *Manager) Subscribe(topic string) chan Packet {
+	messages, first := m.topics.subscribe(topic)
+	if first {
+		m.advertiseTopics()
+	}
+
+	return messages
+}
+
+// Unsubscribe stops sending messages to a channel returned by Subscribe
+func (m *Manager) Unsubscribe(topic string, messages chan Packet) {
+	if m.topics.unsubscribe(topic, messages) {
+		m.advertiseTopics()
+	}
+}
+
+// Publish sends a message to all subscribers of topic, on this node and on the nodes that subscribed to it
+func (m *Manager) Publish(topic string, dataMessage interface{}) error {
+	packet := m.packetFor(dataMessage)
+	packet.Topic = topic
+	if full := m.topics.deliver(*packet); full > 0 {
+		m.log("%s unable to deliver message on topic %s to %d subscribers, channel full!", m.name, topic, full)
+	}
+
+	var errors []string
+	encoded := newEncodedPacket(packet)
+	for _, node := range m.topics.subscribers(topic) {
+		err := m.connectedNodes.writeEncoded(node, encoded)
+		if err != nil { // collect errors, try to send to the others
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("publish failed: %s", strings.Join(errors, ","))
+	}
+
+	return nil
+}
+
+// advertiseTopics sends our subscriptions to all connected nodes
+func (m *Manager) advertiseTopics() {
+	err := m.writeCluster(packetSubscriptions{Topics: m.topics.topics()})
+	if err != nil {
+		m.log("%s Failed to send subscriptions to the cluster. error: %s", m.name, err)
+	}
+}
+
+// sendTopics sends our subscriptions to node
+func (m *Manager) sendTopics(node string) {
+	err := m.writeClusterNode(node, packetSubscriptions{Topics: m.topics.topics()})
+	if err != nil {
+		m.log("%s Failed to send subscriptions to %s. error: %s", m.name, node, err)
+	}
+}
@@ -0,0 +1,56 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+type publishedMessage struct {
+	Value string `json:"value"`
+}
+
+func TestPublish(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerTopic", 3)
+	publisher, subscriber, other := managers[0], managers[1], managers[2]
+	messages := subscriber.Subscribe("jobs")
+	local := publisher.Subscribe("jobs")
+
+	subscribed := func() bool {
+		nodes := publisher.topics.subscribers("jobs")
+		return len(nodes) == 1 && nodes[0] == "managerTopic1"
+	}
+	if !waitFor(5*time.Second, subscribed) {
+		t.Fatalf("expected managerTopic0 to learn the subscription of managerTopic1, but got:%v", publisher.topics.subscribers("jobs"))
+	}
+
+	err := publisher.Publish("jobs", publishedMessage{Value: "run"})
+	if err != nil {
+		t.Errorf("expected publish to succeed, but got error:%s", err)
+	}
+
+	for _, channel := range []chan Packet{messages, local} {
+		packet, timeout := channelReadPacket(channel, 2)
+		if timeout {
+			t.Fatalf("expected published message, but got timeout")
+		}
+
+		message := &publishedMessage{}
+		if err := packet.Message(message); err != nil || message.Value != "run" || packet.Topic != "jobs" {
+			t.Errorf("expected message run on topic jobs, but got:%+v %v", packet, err)
+		}
+	}
+
+	// nodes without subscription do not receive the message
+	select {
+	case packet := <-other.FromCluster:
+		t.Errorf("expected no message on managerTopic2, but got:%+v", packet)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	subscriber.Unsubscribe("jobs", messages)
+	if !waitFor(5*time.Second, func() bool { return len(publisher.topics.subscribers("jobs")) == 0 }) {
+		t.Errorf("expected managerTopic0 to learn the unsubscribe of managerTopic1, but got:%v", publisher.topics.subscribers("jobs"))
+	}
+}
@@ -0,0 +1,209 @@
+package cluster
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ReliableQueueSize the maximum number of unacknowledged reliable packets kept per node
+	ReliableQueueSize = 1000
+)
+
+// reliablePacket is a packet sent with ToClusterReliable waiting to be acknowledged
+type reliablePacket struct {
+	sequence uint64
+	packet   *Packet
+	sent     bool
+}
+
+// reliableQueue keeps track of reliable packets sent to, and received from other nodes
+type reliableQueue struct {
+	sync.Mutex
+	sending  sync.Mutex                  // serializes sending, so packets are sent in order of sequence
+	sequence uint64                      // last sequence number used
+	online   map[string]bool             // nodes we can send packets to
+	pending  map[string][]reliablePacket // unacknowledged packets per node, ordered by sequence
+	received map[string]uint64           // last sequence received per node
+}
+
+func newReliableQueue() *reliableQueue {
+	r := &reliableQueue{
+		// start with the current time, so a restarted node continues with higher sequence numbers
+		sequence: uint64(time.Now().UnixNano()),
+		online:   make(map[string]bool),
+		pending:  make(map[string][]reliablePacket),
+		received: make(map[string]uint64),
+	}
+	return r
+}
+
+func (r *reliableQueue) next() uint64 {
+	r.Lock()
+	defer r.Unlock()
+	r.sequence++
+	return r.sequence
+}
+
+// queue adds a packet to the queue of each node, returns the nodes that dropped a packet due to a full queue
+func (r *reliableQueue) queue(nodes []string, packet *Packet) (dropped []string) {
+	r.Lock()
+	defer r.Unlock()
+	for _, node := range nodes {
+		r.pending[node] = append(r.pending[node], reliablePacket{sequence: packet.Sequence, packet: packet})
+		if len(r.pending[node]) > ReliableQueueSize {
+			r.pending[node] = r.pending[node][1:]
+			dropped = append(dropped, node)
+		}
+	}
+
+	return
+}
+
+// unsent returns the packets not yet sent to an online node, and marks them as sent
+func (r *reliableQueue) unsent(node string) (packets []*Packet) {
+	r.Lock()
+	defer r.Unlock()
+	if !r.online[node] {
+		return
+	}
+
+	for i, packet := range r.pending[node] {
+		if !packet.sent {
+			packets = append(packets, packet.packet)
+			r.pending[node][i].sent = true
+		}
+	}
+
+	return
+}
+
+// setOnline marks a node on or offline, packets of an offline node will be resent when it comes back online
+func (r *reliableQueue) setOnline(node string, online bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.online[node] = online
+	if !online {
+		for i := range r.pending[node] {
+			r.pending[node][i].sent = false
+		}
+	}
+}
+
+// ack removes the packet with sequence from the queue of node. Acknowledgements
+// are not cumulative, internal packets are acknowledged as soon as they are
+// received, while earlier packets can still be waiting for their handler
+func (r *reliableQueue) ack(node string, sequence uint64) {
+	r.Lock()
+	defer r.Unlock()
+	pending := r.pending[node]
+	for i := range pending {
+		if pending[i].sequence == sequence {
+			r.pending[node] = append(pending[:i], pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// remove forgets all state of a node
+func (r *reliableQueue) remove(node string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.online, node)
+	delete(r.pending, node)
+	delete(r.received, node)
+}
+
+// duplicate returns true if the packet of node was received before
+func (r *reliableQueue) duplicate(node string, sequence uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+	return sequence <= r.received[node]
+}
+
+// receive returns true if the packet of node was not received before
+func (r *reliableQueue) receive(node string, sequence uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+	if sequence <= r.received[node] {
+		return false
+	}
+
+	r.received[node] = sequence
+	return true
+}
+
+// writeClusterReliable sends a packet to all nodes, and keeps it queued for nodes that did not acknowledge it
+func (m *Manager) writeClusterReliable(dataMessage interface{}) error {
+	m.reliable.sending.Lock()
+	defer m.reliable.sending.Unlock()
+	packet := m.packetFor(dataMessage)
+	packet.Sequence = m.reliable.next()
+
+	var nodes []string
+	var errors []string
+	for _, node := range m.connectedNodes.nodeNames() {
+		if m.connectedNodes.hasCapability(node, CapabilityReliable) {
+			nodes = append(nodes, node)
+			continue
+		}
+
+		// nodes not supporting reliable delivery never acknowledge, send it only once
+		err := m.connectedNodes.write(node, packet)
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	for _, node := range m.getConfiguredNodes() {
+		if !m.connectedNodes.nodeExists(node.name) {
+			nodes = append(nodes, node.name)
+		}
+	}
+
+	for _, node := range m.reliable.queue(nodes, packet) {
+		m.log("%s Reliable queue for %s is full, dropped the oldest packet", m.name, node)
+	}
+
+	for _, node := range nodes {
+		err := m.flushReliable(node)
+		if err != nil { // collect errors, try to send to the others
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("writeClusterReliable failed: %s", strings.Join(errors, ","))
+	}
+
+	return nil
+}
+
+// resendReliable sends all queued reliable packets not yet sent to node
+func (m *Manager) resendReliable(node string) error {
+	m.reliable.sending.Lock()
+	defer m.reliable.sending.Unlock()
+	return m.flushReliable(node)
+}
+
+// flushReliable sends all queued reliable packets not yet sent to node, the caller must hold the sending lock
+func (m *Manager) flushReliable(node string) error {
+	for _, packet := range m.reliable.unsent(node) {
+		err := m.connectedNodes.write(node, packet)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ackReliable acknowledges the receipt of a reliable packet to its sender
+func (m *Manager) ackReliable(packet Packet) {
+	err := m.writeClusterNode(packet.Name, packetAck{Sequence: packet.Sequence})
+	if err != nil {
+		m.log("%s Failed to acknowledge packet %d of %s. error: %s", m.name, packet.Sequence, packet.Name, err)
+	}
+}
@@ -0,0 +1,254 @@
+package cluster
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestReliableQueue(t *testing.T) {
+	r := newReliableQueue()
+	first, second := r.next(), r.next()
+	r.queue([]string{"node1"}, &Packet{Sequence: first, DataMessage: "first"})
+	r.queue([]string{"node1"}, &Packet{Sequence: second, DataMessage: "second"})
+
+	if packets := r.unsent("node1"); len(packets) != 0 {
+		t.Errorf("expected no packets to be sent to an offline node, but got:%d", len(packets))
+	}
+
+	r.setOnline("node1", true)
+	if packets := r.unsent("node1"); len(packets) != 2 {
+		t.Errorf("expected 2 packets to be sent to node1, but got:%d", len(packets))
+	}
+
+	if packets := r.unsent("node1"); len(packets) != 0 {
+		t.Errorf("expected packets to be sent to node1 only once, but got:%d", len(packets))
+	}
+
+	// a reconnect resends all unacknowledged packets
+	r.ack("node1", first)
+	r.setOnline("node1", false)
+	r.setOnline("node1", true)
+	if packets := r.unsent("node1"); len(packets) != 1 || packets[0].DataMessage != "second" {
+		t.Errorf("expected only the second packet to be resent to node1, but got:%+v", packets)
+	}
+
+	// acknowledgements are not cumulative
+	third := r.next()
+	r.queue([]string{"node1"}, &Packet{Sequence: third, DataMessage: "third"})
+	r.ack("node1", third)
+	r.setOnline("node1", false)
+	r.setOnline("node1", true)
+	if packets := r.unsent("node1"); len(packets) != 1 || packets[0].DataMessage != "second" {
+		t.Errorf("expected the second packet to be kept after acknowledging the third, but got:%+v", packets)
+	}
+
+	if !r.receive("node2", first) {
+		t.Errorf("expected first packet of node2 to be new")
+	}
+
+	if r.receive("node2", first) {
+		t.Errorf("expected duplicate packet of node2 to be suppressed")
+	}
+}
+
+func TestReliableDelivery(t *testing.T) {
+	t.Parallel()
+
+	managerA := NewManager("managerReliableA", "secret")
+	managerA.AddNode("managerReliableB", "127.0.0.1:9516")
+	err := managerA.ListenAndServe("127.0.0.1:9515")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// managerReliableB is not running yet, the message should be delivered once it joins
+	if timeout := channelWriteTimeout(managerA.ToClusterReliable, Message{Message: "Hello Reliable"}, 2); timeout {
+		t.Errorf("expected write to managerReliableA.ToClusterReliable to work, but it timedout")
+	}
+
+	managerB := NewManager("managerReliableB", "secret")
+	managerB.AddNode("managerReliableA", "127.0.0.1:9515")
+	err = managerB.ListenAndServe("127.0.0.1:9516")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	packet, timeout := channelReadPacket(managerB.FromCluster, 5)
+	if timeout {
+		t.Errorf("expected data FromCluster on managerReliableB, but got timeout")
+	} else {
+		msg := &Message{}
+		err := packet.Message(msg)
+		if err != nil {
+			t.Errorf("unable to unpack the message received from managerReliableB.FromCluster error:%s", err)
+		} else if msg.Message != "Hello Reliable" {
+			t.Errorf("expected managerReliableB.FromCluster to return 'Hello Reliable' but got:%s", msg)
+		}
+	}
+
+	if _, timeout := channelReadPacket(managerB.FromCluster, 1); !timeout {
+		t.Errorf("expected the reliable message to be delivered once to managerReliableB, but got it again")
+	}
+
+	logs := channelReadStrings(managerA.Log, 1)
+	if DebugLog == 1 || t.Failed() {
+		for _, log := range logs {
+			t.Log("== LOG managerReliableA: ", log)
+		}
+	}
+
+	managerA.Shutdown(context.Background())
+	managerB.Shutdown(context.Background())
+}
+
+func TestReliableRestart(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerRestartA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerRestartB", "restartB")
+	if err := managerA.ListenAndServeTransport("restartA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerRestartB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerRestartA", "restartA")
+	handling, release := make(chan struct{}, 1), make(chan struct{})
+	defer close(release)
+	managerB.Handle(handledMessage{}, func(from string, msg handledMessage) {
+		handling <- struct{}{}
+		<-release
+	})
+	if err := managerB.ListenAndServeTransport("restartB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected managerRestartB to join")
+	}
+
+	pending := func() int {
+		managerA.reliable.Lock()
+		defer managerA.reliable.Unlock()
+		return len(managerA.reliable.pending["managerRestartB"])
+	}
+
+	// the handler of managerRestartB holds the message, while a key/value update sent after it is acknowledged
+	managerA.ToClusterReliable <- handledMessage{Value: 1}
+	select {
+	case <-handling:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected managerRestartB to handle the message")
+	}
+
+	if err := managerA.Put("restart", []byte("value")); err != nil {
+		t.Fatalf("expected put to work, but got:%s", err)
+	}
+	if !waitFor(5*time.Second, func() bool { return pending() < 2 }) {
+		t.Fatalf("expected the key/value update to be acknowledged, but got:%d pending", pending())
+	}
+	if n := pending(); n != 1 {
+		t.Fatalf("expected the handled message to stay unacknowledged, but got:%d pending", n)
+	}
+
+	// the handler is stuck, so the shutdown does not complete
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	managerB.Shutdown(ctx)
+
+	restarted := NewManager("managerRestartB", "secret")
+	restarted.UpdateSettings(settings)
+	restarted.AddNode("managerRestartA", "restartA")
+	if err := restarted.ListenAndServeTransport("restartB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer restarted.Shutdown(context.Background())
+
+	packet, timeout := channelReadPacket(restarted.FromCluster, 5)
+	if timeout {
+		t.Fatalf("expected the message to be resent to the restarted managerRestartB, but got timeout")
+	}
+	msg := handledMessage{}
+	if err := packet.Message(&msg); err != nil || msg.Value != 1 {
+		t.Errorf("expected the resent message to have value 1, but got:%+v error:%v", msg, err)
+	}
+
+	if !waitFor(5*time.Second, func() bool { return pending() == 0 }) {
+		t.Errorf("expected the resent message to be acknowledged, but got:%d pending", pending())
+	}
+}
+
+func TestReliableSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+
+	managerA := NewManager("managerSlowA", "secret")
+	managerA.UpdateSettings(settings)
+	managerA.AddNode("managerSlowB", "slowB")
+	if err := managerA.ListenAndServeTransport("slowA", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerA.Shutdown(context.Background())
+
+	managerB := NewManager("managerSlowB", "secret")
+	managerB.UpdateSettings(settings)
+	managerB.AddNode("managerSlowA", "slowA")
+	if err := managerB.ListenAndServeTransport("slowB", network); err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+	defer managerB.Shutdown(context.Background())
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected managerSlowB to join")
+	}
+
+	// managerSlowB does not read FromCluster, while more messages arrive than fit in the channel
+	messages := ChannelBufferSize + 50
+	for i := 0; i < messages; i++ {
+		managerA.ToClusterReliable <- Message{Message: "slow"}
+	}
+
+	pending := func() int {
+		managerA.reliable.Lock()
+		defer managerA.reliable.Unlock()
+		return len(managerA.reliable.pending["managerSlowB"])
+	}
+	if !waitFor(5*time.Second, func() bool { return len(managerB.FromCluster) == ChannelBufferSize }) {
+		t.Fatalf("expected FromCluster of managerSlowB to fill up, but got:%d", len(managerB.FromCluster))
+	}
+
+	// the packet manager of managerSlowB still answers requests
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := managerA.Call(ctx, "managerSlowB", packetProbe{}, nil); err != nil {
+		t.Errorf("expected managerSlowB to answer while its application is slow, but got:%s", err)
+	}
+
+	// messages are only acknowledged once the application received them
+	if n := pending(); n < messages-ChannelBufferSize-1 {
+		t.Errorf("expected at least %d unacknowledged messages, but got:%d", messages-ChannelBufferSize-1, n)
+	}
+
+	for i := 0; i < messages; i++ {
+		if _, timeout := channelReadPacket(managerB.FromCluster, 2); timeout {
+			t.Fatalf("expected %d messages on managerSlowB, but got:%d", messages, i)
+		}
+	}
+
+	if !waitFor(5*time.Second, func() bool { return pending() == 0 }) {
+		t.Errorf("expected all messages to be acknowledged, but got:%d pending", pending())
+	}
+}
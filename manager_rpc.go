@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// CallHandler handles a request made with Call by a remote node, the returned response or error is sent back to the caller
+type CallHandler func(packet Packet) (response interface{}, err error)
+
+// pendingCall is a request waiting for a response
+type pendingCall struct {
+	node  string
+	reply chan Packet
+}
+
+type callPool struct {
+	sync.Mutex
+	lastID  uint64
+	pending map[string]pendingCall
+}
+
+func newCallPool() *callPool {
+	c := &callPool{
+		pending: make(map[string]pendingCall),
+	}
+	return c
+}
+
+func (c *callPool) add(node string) (string, chan Packet) {
+	id := fmt.Sprintf("%d", atomic.AddUint64(&c.lastID, 1))
+	reply := make(chan Packet, 1)
+	c.Lock()
+	defer c.Unlock()
+	c.pending[id] = pendingCall{node: node, reply: reply}
+	return id, reply
+}
+
+func (c *callPool) remove(id string) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.pending, id)
+}
+
+// resolve passes a response to the request waiting for it
+func (c *callPool) resolve(packet Packet) bool {
+	c.Lock()
+	defer c.Unlock()
+	call, ok := c.pending[packet.RequestID]
+	if !ok || call.node != packet.Name {
+		return false
+	}
+
+	delete(c.pending, packet.RequestID)
+	call.reply <- packet
+	return true
+}
+
+// cancelNode fails all requests waiting for a response of node
+func (c *callPool) cancelNode(node string, err error) {
+	c.Lock()
+	defer c.Unlock()
+	for id, call := range c.pending {
+		if call.node == node {
+			delete(c.pending, id)
+			call.reply <- Packet{Name: node, RequestID: id, Response: true, Error: err.Error()}
+		}
+	}
+}
+
+// HandleCall registers a handler for requests made with Call of the given data type
+func (m *Manager) HandleCall(dataType string, handler CallHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.callHandlers[dataType] = handler
+}
+
+// Call sends a request to node, and waits for its response to be decoded in to response
+// The request is handled on the remote node by the handler registered with HandleCall for its data type
+func (m *Manager) Call(ctx context.Context, node string, request interface{}, response interface{}) error {
+	id, reply := m.calls.add(node)
+	defer m.calls.remove(id)
+
+	packet := m.packetFor(request)
+	packet.RequestID = id
+	if LogTraffic {
+		m.log("%s traffic call to cluster node %s (%s): %+v", m.name, node, id, request)
+	}
+
+	err := m.connectedNodes.write(node, packet)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case packet := <-reply:
+		if packet.Error != "" {
+			return fmt.Errorf("call to %s failed: %s", node, packet.Error)
+		}
+
+		if response == nil {
+			return nil
+		}
+
+		return packet.Message(response)
+
+	case <-m.quit:
+		return fmt.Errorf("call to %s failed: cluster node %s is shutting down", node, m.name)
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleCallPacket processes requests and responses of Call
+func (m *Manager) handleCallPacket(packet Packet) {
+	if packet.Response {
+		if !m.calls.resolve(packet) {
+			m.log("%s Received response %s from %s for an unknown request", m.name, packet.RequestID, packet.Name)
+		}
+		return
+	}
+
+	m.mu.RLock()
+	handler, ok := m.callHandlers[packet.DataType]
+	m.mu.RUnlock()
+
+	// run the handler in the background, so we don't block incomming packets
+	m.spawn(func() {
+		var response interface{}
+		var err error
+		if ok {
+			response, err = handler(packet)
+		} else {
+			err = fmt.Errorf("no handler registered for %s", packet.DataType)
+		}
+
+		reply := m.packetFor(response)
+		reply.RequestID = packet.RequestID
+		reply.Response = true
+		if err != nil {
+			reply.Error = err.Error()
+		}
+
+		err = m.connectedNodes.write(packet.Name, reply)
+		if err != nil {
+			m.log("%s Failed to send response to %s. error: %s", m.name, packet.Name, err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"testing"
+	"time"
+)
+
+type callRequest struct {
+	Value int `json:"value"`
+}
+
+type callResponse struct {
+	Value int `json:"value"`
+}
+
+func TestCall(t *testing.T) {
+	t.Parallel()
+
+	managerA := NewManager("managerCallA", "secret")
+	managerA.AddNode("managerCallB", "127.0.0.1:9514")
+	err := managerA.ListenAndServe("127.0.0.1:9513")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	managerB := NewManager("managerCallB", "secret")
+	managerB.AddNode("managerCallA", "127.0.0.1:9513")
+	managerB.HandleCall("cluster.callRequest", func(packet Packet) (interface{}, error) {
+		request := &callRequest{}
+		if err := packet.Message(request); err != nil {
+			return nil, err
+		}
+
+		if request.Value < 0 {
+			return nil, fmt.Errorf("negative value")
+		}
+
+		return callResponse{Value: request.Value * 2}, nil
+	})
+	err = managerB.ListenAndServe("127.0.0.1:9514")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on managerCallA, but got timeout")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	response := &callResponse{}
+	err = managerA.Call(ctx, "managerCallB", callRequest{Value: 21}, response)
+	if err != nil {
+		t.Errorf("expected call to managerCallB to succeed, but got error:%s", err)
+	}
+
+	if response.Value != 42 {
+		t.Errorf("expected call to managerCallB to return 42, but got:%d", response.Value)
+	}
+
+	// errors of the remote handler are returned to the caller
+	err = managerA.Call(ctx, "managerCallB", callRequest{Value: -1}, response)
+	if err == nil {
+		t.Errorf("expected call to managerCallB with a negative value to fail, but got no error")
+	}
+
+	// requests without a handler return an error
+	err = managerA.Call(ctx, "managerCallB", Message{Message: "no handler"}, nil)
+	if err == nil {
+		t.Errorf("expected call to managerCallB without a handler to fail, but got no error")
+	}
+
+	// requests to unknown nodes fail directly
+	err = managerA.Call(ctx, "managerCallC", callRequest{Value: 1}, response)
+	if err == nil {
+		t.Errorf("expected call to unknown node to fail, but got no error")
+	}
+
+	// requests without a response are cancelled by the context
+	managerA.HandleCall("cluster.callRequest", func(packet Packet) (interface{}, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	})
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+	err = managerB.Call(shortCtx, "managerCallA", callRequest{Value: 1}, response)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected call to managerCallA to exceed its deadline, but got:%v", err)
+	}
+
+	logs := channelReadStrings(managerA.Log, 1)
+	if DebugLog == 1 || t.Failed() {
+		for _, log := range logs {
+			t.Log("== LOG managerCallA: ", log)
+		}
+	}
+
+	managerA.Shutdown(context.Background())
+	managerB.Shutdown(context.Background())
+}
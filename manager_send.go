@@ -0,0 +1,73 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// sendResult is the result of writing a packet to a node
+type sendResult struct {
+	node string
+	err  error
+}
+
+// Send writes msg to node, and returns once it was written or ctx is done
+// Unlike ToNode, write errors are returned to the caller instead of logged. A write that
+// is aborted because ctx is done closes the connection to the node, as the packet may have
+// been written partially. The packet is never written after Send returned.
+func (m *Manager) Send(ctx context.Context, node string, msg interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	n, ok := m.connectedNodes.getNode(node)
+	if !ok {
+		return fmt.Errorf("write failed: node not found: %s", node)
+	}
+
+	return n.writeContext(ctx, newEncodedPacket(m.packetFor(msg)))
+}
+
+// Broadcast writes msg to all configured nodes, and returns the result per node once all writes finished or ctx is done
+// Configured nodes we are not connected to have a not connected error, and writes aborted because ctx is done
+// have the error of ctx, like with Send. The returned error is set if any write failed.
+func (m *Manager) Broadcast(ctx context.Context, msg interface{}) (map[string]error, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	packet := newEncodedPacket(m.packetFor(msg))
+	nodes := m.connectedNodes.getAllNodes()
+	results := make(chan sendResult, len(nodes))
+	for _, node := range nodes {
+		go func(node *Node) {
+			results <- sendResult{node: node.name, err: node.writeContext(ctx, packet)}
+		}(node)
+	}
+
+	errs := make(map[string]error)
+	for _, configured := range m.getConfiguredNodes() {
+		errs[configured.name] = fmt.Errorf("not connected")
+	}
+
+	for range nodes {
+		result := <-results // each write returns once ctx is done
+		errs[result.node] = result.err
+	}
+
+	var failed []string
+	for node, err := range errs {
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", node, err))
+		}
+	}
+
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return errs, fmt.Errorf("broadcast failed for %d of %d nodes: %s", len(failed), len(errs), strings.Join(failed, ", "))
+	}
+
+	return errs, nil
+}
@@ -0,0 +1,103 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+type sentMessage struct {
+	Value string `json:"value"`
+}
+
+func TestSendBroadcast(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerSend", 3)
+
+	sender := managers[0]
+	if !waitFor(5*time.Second, func() bool { return len(sender.connectedNodes.getAllNodes()) == 2 }) {
+		t.Fatalf("expected managers to connect")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := sender.Send(ctx, "managerSend1", sentMessage{Value: "direct"}); err != nil {
+		t.Errorf("expected send to succeed, but got:%s", err)
+	}
+
+	packet, timeout := channelReadPacket(managers[1].FromCluster, 2)
+	message := &sentMessage{}
+	if timeout || packet.Message(message) != nil || message.Value != "direct" {
+		t.Errorf("expected message direct on managerSend1, but got:%+v (timeout:%t)", packet, timeout)
+	}
+
+	if err := sender.Send(ctx, "managerSendUnknown", sentMessage{}); err == nil {
+		t.Errorf("expected send to an unknown node to fail")
+	}
+
+	results, err := sender.Broadcast(ctx, sentMessage{Value: "all"})
+	if err != nil || len(results) != 2 || results["managerSend1"] != nil || results["managerSend2"] != nil {
+		t.Errorf("expected broadcast to succeed for 2 nodes, but got:%v %v", results, err)
+	}
+
+	for _, manager := range managers[1:] {
+		packet, timeout := channelReadPacket(manager.FromCluster, 2)
+		if timeout || packet.Message(message) != nil || message.Value != "all" {
+			t.Errorf("expected message all on %s, but got:%+v (timeout:%t)", manager.name, packet, timeout)
+		}
+	}
+
+	// configured nodes we are not connected to are reported as well
+	sender.addNode("managerSendOffline", "sendOffline")
+	results, err = sender.Broadcast(ctx, sentMessage{Value: "offline"})
+	if err == nil || len(results) != 3 || results["managerSend1"] != nil || results["managerSendOffline"] == nil {
+		t.Errorf("expected broadcast to fail for managerSendOffline only, but got:%v %v", results, err)
+	}
+
+	cancel()
+	if _, err := sender.Broadcast(ctx, sentMessage{}); err != context.Canceled {
+		t.Errorf("expected broadcast with a cancelled context to fail, but got:%v", err)
+	}
+
+	if err := sender.Send(ctx, "managerSend1", sentMessage{}); err != context.Canceled {
+		t.Errorf("expected send with a cancelled context to fail, but got:%v", err)
+	}
+}
+
+func TestSendAborted(t *testing.T) {
+	manager := NewManager("managerSendAborted", "secret")
+	defer removeManager(manager.name)
+
+	for _, cancelled := range []bool{false, true} {
+		dialSide, listenSide := net.Pipe() // nobody reads, so writes block
+		node := newNode("managerSendBlocked", dialSide, nil, framing{}, false)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		expected := context.DeadlineExceeded
+		if cancelled {
+			ctx, cancel = context.WithCancel(context.Background())
+			expected = context.Canceled
+			time.AfterFunc(100*time.Millisecond, cancel)
+		}
+
+		start := time.Now()
+		err := node.writeContext(ctx, newEncodedPacket(manager.packetFor(sentMessage{Value: "blocked"})))
+		cancel()
+		if err != expected || time.Since(start) > time.Second {
+			t.Errorf("expected the write to be aborted with %v, but got:%v after %v", expected, err, time.Since(start))
+		}
+
+		// the connection is closed, so the packet can not be written after we returned
+		if !node.closed() {
+			t.Errorf("expected the connection to be closed after an aborted write")
+		}
+
+		if n, err := listenSide.Read(make([]byte, 1024)); err == nil {
+			t.Errorf("expected nothing to be written after the write was aborted, but got %d bytes", n)
+		}
+		listenSide.Close()
+	}
+}
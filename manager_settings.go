@@ -9,9 +9,21 @@ import (
 type Settings struct {
 	PingInterval    time.Duration // how over to ping a node
 	JoinDelay       time.Duration // delay before announcing node (done to prevent duplicate join messages on simultainious connects) (must be shorter than ping timeout)
-	ReadTimeout     time.Duration // timeout when to discard a node as broken if not read anything before this
+	ReadTimeout     time.Duration // timeout when to discard a node as broken if not read anything before this, regardless of the failure detector
 	ConnectInterval time.Duration // how often we try to reconnect to lost cluster nodes
 	ConnectTimeout  time.Duration // how long to try to connect to a node
+	MaxBackoff      time.Duration // maximum time between attempts to connect to an unreachable node
+	GossipInterval  time.Duration // how often we share the cluster membership with a random node
+	Codec           string        // codec we prefer for connections to other nodes, empty to use the JSON newline format
+	Compression     string        // compressor for messages we send, empty to not compress
+	CompressionSize int           // minimum size in bytes of messages to compress
+	StrictTypes     bool          // drop received messages of types not registered with RegisterType
+	ShutdownTimeout time.Duration // how long Run waits for the cluster node to shut down
+	MaxClockSkew    time.Duration // maximum offset of the clock of other nodes before a ClockSkew event is sent, 0 to disable
+
+	SuspicionThreshold float64       // phi of the failure detector above which a node is suspected to have failed, 0 to disable
+	FailureThreshold   float64       // phi of the failure detector above which a node is disconnected, 0 to disable
+	AcceptablePause    time.Duration // pause between pings of a node the failure detector accepts before it grows suspicious
 }
 
 func defaultSetting() Settings {
@@ -21,20 +33,31 @@ func defaultSetting() Settings {
 		ReadTimeout:     11 * time.Second,
 		ConnectInterval: 2 * time.Second,
 		ConnectTimeout:  10 * time.Second,
+		MaxBackoff:      30 * time.Second,
+		GossipInterval:  5 * time.Second,
+		Codec:           "json",
+		Compression:     "gzip",
+		CompressionSize: 64 * 1024,
+		ShutdownTimeout: 10 * time.Second,
+		MaxClockSkew:    time.Second,
+
+		SuspicionThreshold: 3,
+		FailureThreshold:   16,
+		AcceptablePause:    time.Second,
 	}
 	return s
 }
 
 // UpdateSettings allows you to update a running cluster node with new settings
 func (m *Manager) UpdateSettings(settings Settings) {
-	m.Lock()
-	defer m.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.settings = settings
 }
 
 func (m *Manager) getDuration(setting string) time.Duration {
-	m.RLock()
-	defer m.RUnlock()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	switch setting {
 	case "pinginterval":
 		return m.settings.PingInterval
@@ -48,11 +71,61 @@ func (m *Manager) getDuration(setting string) time.Duration {
 	case "connectinterval":
 		return m.settings.ConnectInterval
 
+	case "maxbackoff":
+		return m.settings.MaxBackoff
+
 	case "readtimeout":
 		return m.settings.ReadTimeout
 
+	case "gossipinterval":
+		return m.settings.GossipInterval
+
+	case "shutdowntimeout":
+		return m.settings.ShutdownTimeout
+
+	case "maxclockskew":
+		return m.settings.MaxClockSkew
+
+	case "acceptablepause":
+		return m.settings.AcceptablePause
+
 	default:
 		log.Fatalf("Unknown setting: %s", setting)
 		return 0
 	}
 }
+
+// preferredCodec returns the codec we prefer for connections to other nodes
+func (m *Manager) preferredCodec() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings.Codec
+}
+
+// failureThresholds returns the phi thresholds of the failure detector
+func (m *Manager) failureThresholds() (suspicion, failure float64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings.SuspicionThreshold, m.settings.FailureThreshold
+}
+
+// strictTypes returns true if messages of unregistered types are dropped
+func (m *Manager) strictTypes() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.settings.StrictTypes
+}
+
+// compressorFor returns the compressor and threshold for messages we send to a node supporting compressors
+func (m *Manager) compressorFor(supported []string) (Compressor, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, name := range supported {
+		if name == m.settings.Compression {
+			compressor, _ := getCompressor(name)
+			return compressor, m.settings.CompressionSize
+		}
+	}
+
+	return nil, 0
+}
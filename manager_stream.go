@@ -0,0 +1,367 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Streams are sent as chunks, which are interleaved with other packets on the
+// connection. The receiver acknowledges the data read by the client
+// application, and the sender keeps at most StreamWindow chunks that were not
+// acknowledged yet. Unacknowledged chunks are resent when the node reconnects
+// or no acknowledgement arrived within the read timeout, and chunks received
+// twice are ignored. Each chunk has a crc32 checksum, and the final chunk a
+// sha256 checksum of the whole stream.
+
+var (
+	// StreamChunkSize is the size of the chunks a stream is sent in
+	StreamChunkSize = 64 * 1024
+	// StreamWindow is the number of chunks sent before waiting for the receiver to read them
+	StreamWindow = 16
+)
+
+// streamLinger is how long we remember finished streams, to acknowledge chunks resent by the sender
+const streamLinger = time.Minute
+
+// streamChunkType is the data type of stream chunks, which are never dropped when the packet manager is busy
+const streamChunkType = "cluster.packetStreamChunk"
+
+// Stream is a stream of data received from another node
+type Stream struct {
+	ID      string // id of the stream, unique for the sending node
+	Node    string // node sending the stream
+	manager *Manager
+	chunks  chan packetStreamChunk
+	closed  chan struct{}
+
+	closeOnce sync.Once
+	received  uint64 // offset of the next chunk expected, accessed by the packet manager only
+	consumed  uint64 // offset of the data read by the client application
+	buf       []byte
+	hash      hash.Hash
+	err       error
+}
+
+// Read reads data of the stream, it returns io.EOF once all data was received and passed the integrity check
+func (s *Stream) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		select {
+		case chunk := <-s.chunks:
+			s.readChunk(chunk)
+		case <-s.closed:
+			return 0, io.ErrClosedPipe
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	if len(s.buf) == 0 {
+		s.ack(false, "")
+	}
+
+	return n, nil
+}
+
+func (s *Stream) readChunk(chunk packetStreamChunk) {
+	switch {
+	case chunk.Abort != "":
+		s.err = fmt.Errorf("stream %s aborted by %s: %s", s.ID, s.Node, chunk.Abort)
+
+	case chunk.Final:
+		s.err = io.EOF
+		if checksum := hex.EncodeToString(s.hash.Sum(nil)); checksum != chunk.Checksum {
+			s.err = fmt.Errorf("stream %s of %s failed the integrity check", s.ID, s.Node)
+		}
+
+		errStr := ""
+		if s.err != io.EOF {
+			errStr = s.err.Error()
+		}
+		s.manager.streams.finish(s, errStr)
+		s.ack(true, errStr)
+
+	default:
+		s.hash.Write(chunk.Data)
+		s.buf = chunk.Data
+		atomic.StoreUint64(&s.consumed, chunk.Offset+uint64(len(chunk.Data)))
+	}
+}
+
+// Close discards the rest of the stream, the sender fails if it did not finish yet
+func (s *Stream) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	if s.manager.streams.finish(s, "stream closed by receiver") {
+		s.ack(true, "stream closed by receiver")
+	}
+	return nil
+}
+
+// ack informs the sender of the data read
+func (s *Stream) ack(done bool, err string) {
+	ack := packetStreamAck{ID: s.ID, Offset: atomic.LoadUint64(&s.consumed), Done: done, Error: err}
+	if werr := s.manager.writeClusterNode(s.Node, ack); werr != nil {
+		s.manager.log("%s Failed to acknowledge stream %s of %s. error: %s", s.manager.name, s.ID, s.Node, werr)
+	}
+}
+
+// outgoingStream is a stream we are sending
+type outgoingStream struct {
+	id     string
+	node   string
+	acks   chan packetStreamAck
+	resume chan struct{}
+}
+
+type streamPool struct {
+	sync.Mutex
+	lastID    uint64
+	outgoing  map[string]*outgoingStream
+	incomming map[string]*Stream // streams per node and id
+	finished  map[string]string  // error of streams finished recently per node and id
+}
+
+func newStreamPool() *streamPool {
+	s := &streamPool{
+		lastID:    uint64(time.Now().UnixNano()),
+		outgoing:  make(map[string]*outgoingStream),
+		incomming: make(map[string]*Stream),
+		finished:  make(map[string]string),
+	}
+	return s
+}
+
+func streamKey(node, id string) string {
+	return node + "/" + id
+}
+
+func (s *streamPool) addOutgoing(node string) *outgoingStream {
+	s.Lock()
+	defer s.Unlock()
+	s.lastID++
+	out := &outgoingStream{
+		id:     strconv.FormatUint(s.lastID, 10),
+		node:   node,
+		acks:   make(chan packetStreamAck, StreamWindow+1),
+		resume: make(chan struct{}, 1),
+	}
+	s.outgoing[out.id] = out
+	return out
+}
+
+func (s *streamPool) removeOutgoing(out *outgoingStream) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.outgoing, out.id)
+}
+
+// ack passes an acknowledgement to the outgoing stream
+func (s *streamPool) ack(node string, ack packetStreamAck) {
+	s.Lock()
+	defer s.Unlock()
+	if out, ok := s.outgoing[ack.ID]; ok && out.node == node {
+		select {
+		case out.acks <- ack:
+		default:
+		}
+	}
+}
+
+// resume resends the unacknowledged chunks of all streams to node
+func (s *streamPool) resume(node string) {
+	s.Lock()
+	defer s.Unlock()
+	for _, out := range s.outgoing {
+		if out.node == node {
+			select {
+			case out.resume <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// incommingStream returns the stream a chunk belongs to, creating it on the first chunk
+// finished is true if the stream was finished before, with its error
+func (s *streamPool) incommingStream(m *Manager, node string, chunk packetStreamChunk) (stream *Stream, created, finished bool, err string) {
+	s.Lock()
+	defer s.Unlock()
+	key := streamKey(node, chunk.ID)
+	if err, ok := s.finished[key]; ok {
+		return nil, false, true, err
+	}
+
+	if stream, ok := s.incomming[key]; ok {
+		return stream, false, false, ""
+	}
+
+	if chunk.Offset != 0 || chunk.Abort != "" {
+		return nil, false, false, "" // we do not know the start of this stream
+	}
+
+	stream = &Stream{
+		ID:      chunk.ID,
+		Node:    node,
+		manager: m,
+		chunks:  make(chan packetStreamChunk, StreamWindow+1),
+		closed:  make(chan struct{}),
+		hash:    sha256.New(),
+	}
+	s.incomming[key] = stream
+	return stream, true, false, ""
+}
+
+// finish forgets a stream, remembering its result for a while, returns false if it was finished before
+func (s *streamPool) finish(stream *Stream, err string) bool {
+	s.Lock()
+	defer s.Unlock()
+	key := streamKey(stream.Node, stream.ID)
+	if _, ok := s.incomming[key]; !ok {
+		return false
+	}
+
+	delete(s.incomming, key)
+	s.finished[key] = err
+	time.AfterFunc(streamLinger, func() {
+		s.Lock()
+		defer s.Unlock()
+		delete(s.finished, key)
+	})
+	return true
+}
+
+// SendStream sends all data of reader to node, which receives it on its Streams channel
+// It returns once the remote node read all data, and resends data lost when the node reconnects
+func (m *Manager) SendStream(ctx context.Context, node string, reader io.Reader) error {
+	out := m.streams.addOutgoing(node)
+	defer m.streams.removeOutgoing(out)
+
+	checksum := sha256.New()
+	var unacked []packetStreamChunk
+	var offset uint64
+	eof := false
+	for {
+		// send chunks until the window is full
+		for !eof && len(unacked) < StreamWindow {
+			data := make([]byte, StreamChunkSize)
+			n, err := io.ReadFull(reader, data)
+			if n > 0 {
+				chunk := packetStreamChunk{ID: out.id, Offset: offset, Data: data[:n], CRC: crc32.ChecksumIEEE(data[:n])}
+				checksum.Write(chunk.Data)
+				offset += uint64(n)
+				unacked = append(unacked, chunk)
+				m.writeStreamChunk(node, chunk)
+			}
+
+			switch err {
+			case nil:
+			case io.EOF, io.ErrUnexpectedEOF:
+				eof = true
+				final := packetStreamChunk{ID: out.id, Offset: offset, Final: true, Checksum: hex.EncodeToString(checksum.Sum(nil))}
+				unacked = append(unacked, final)
+				m.writeStreamChunk(node, final)
+			default:
+				m.writeStreamChunk(node, packetStreamChunk{ID: out.id, Offset: offset, Abort: err.Error()})
+				return fmt.Errorf("failed to read stream for %s: %s", node, err)
+			}
+		}
+
+		select {
+		case ack := <-out.acks:
+			if ack.Error != "" {
+				return fmt.Errorf("stream to %s failed: %s", node, ack.Error)
+			}
+
+			if ack.Done {
+				return nil
+			}
+
+			for len(unacked) > 0 && !unacked[0].Final && unacked[0].Offset+uint64(len(unacked[0].Data)) <= ack.Offset {
+				unacked = unacked[1:]
+			}
+
+		case <-out.resume:
+			m.log("%s Resuming stream %s to %s at offset %d", m.name, out.id, node, unacked[0].Offset)
+			for _, chunk := range unacked {
+				m.writeStreamChunk(node, chunk)
+			}
+
+		case <-time.After(m.getDuration("readtimeout")):
+			for _, chunk := range unacked {
+				m.writeStreamChunk(node, chunk)
+			}
+
+		case <-ctx.Done():
+			m.writeStreamChunk(node, packetStreamChunk{ID: out.id, Offset: offset, Abort: ctx.Err().Error()})
+			return ctx.Err()
+		}
+	}
+}
+
+// writeStreamChunk sends a chunk, chunks failing to send are resent later
+func (m *Manager) writeStreamChunk(node string, chunk packetStreamChunk) {
+	err := m.writeClusterNode(node, chunk)
+	if err != nil {
+		m.log("%s Failed to send chunk of stream %s to %s, it will be resent. error: %s", m.name, chunk.ID, node, err)
+	}
+}
+
+// handleStreamChunk passes a received chunk to its stream
+func (m *Manager) handleStreamChunk(node string, chunk packetStreamChunk) {
+	if !chunk.Final && chunk.Abort == "" && crc32.ChecksumIEEE(chunk.Data) != chunk.CRC {
+		m.log("%s Dropping corrupt chunk of stream %s from %s at offset %d", m.name, chunk.ID, node, chunk.Offset)
+		return // the sender resends it
+	}
+
+	stream, created, finished, err := m.streams.incommingStream(m, node, chunk)
+	if finished {
+		// the sender did not receive our last acknowledgement
+		m.writeClusterNode(node, packetStreamAck{ID: chunk.ID, Offset: chunk.Offset, Done: true, Error: err})
+		return
+	}
+
+	if stream == nil {
+		m.log("%s Dropping chunk of unknown stream %s from %s", m.name, chunk.ID, node)
+		return
+	}
+
+	if chunk.Offset != stream.received && chunk.Abort == "" {
+		// chunks resent after a reconnect, tell the sender what we already read
+		stream.ack(false, "")
+		return
+	}
+
+	stream.received = chunk.Offset + uint64(len(chunk.Data))
+	select {
+	case stream.chunks <- chunk:
+	default:
+		m.log("%s Stream %s from %s exceeds its window, dropping chunk", m.name, chunk.ID, node)
+		stream.received = chunk.Offset
+	}
+
+	if created {
+		select {
+		case m.Streams <- stream: // new stream to client application
+		default:
+			m.log("%s Unable to write stream %s of %s to Streams. Channel full!", m.name, chunk.ID, node)
+			if m.streams.finish(stream, "receiver is unable to accept streams") {
+				stream.ack(true, "receiver is unable to accept streams")
+			}
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestSendStream(t *testing.T) {
+	t.Parallel()
+
+	managers := startMemoryCluster(t, "managerStream", 2)
+	managerA, managerB := managers[0], managers[1]
+
+	if _, timeout := channelReadString(managerA.NodeJoin, 5); timeout {
+		t.Fatalf("expected Join on managerStream0, but got timeout")
+	}
+
+	// more data than fits in the window
+	data := make([]byte, 3*StreamWindow*StreamChunkSize+100)
+	rand.Read(data)
+
+	received := make(chan []byte, 1)
+	go func() {
+		select {
+		case stream := <-managerB.Streams:
+			body, err := ioutil.ReadAll(stream)
+			if err != nil {
+				t.Errorf("expected stream to be read, but got:%s", err)
+			}
+			received <- body
+		case <-time.After(5 * time.Second):
+			received <- nil
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := managerA.SendStream(ctx, "managerStream1", bytes.NewReader(data)); err != nil {
+		t.Errorf("expected stream to be sent, but got:%s", err)
+	}
+
+	if body := <-received; !bytes.Equal(body, data) {
+		t.Errorf("expected %d bytes on managerStream1, but got:%d", len(data), len(body))
+	}
+}
+
+func TestStreamIntegrity(t *testing.T) {
+	manager := NewManager("managerStreamIntegrity", "secret")
+	stream, created, _, _ := manager.streams.incommingStream(manager, "node1", packetStreamChunk{ID: "1"})
+	if !created {
+		t.Fatalf("expected a new stream")
+	}
+
+	stream.chunks <- packetStreamChunk{ID: "1", Data: []byte("data")}
+	stream.chunks <- packetStreamChunk{ID: "1", Offset: 4, Final: true, Checksum: "invalid"}
+	if _, err := ioutil.ReadAll(stream); err == nil {
+		t.Errorf("expected stream with an invalid checksum to fail")
+	}
+}
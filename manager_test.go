@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"crypto/tls"
 	"log"
 	"reflect"
@@ -54,7 +55,7 @@ func TestOneClusterNode(t *testing.T) {
 		}
 	}
 
-	managerONE.Shutdown()
+	managerONE.Shutdown(context.Background())
 
 	if _, timeout := channelReadString(managerONE.NodeLeave, 1); !timeout {
 		t.Errorf("Read from cluster manager.nodeLeave should timeout (we don't send to self). but we received data instead")
@@ -144,7 +145,7 @@ func TestTwoClusterNode(t *testing.T) {
 		}
 	}
 
-	managerTWO.Shutdown()
+	managerTWO.Shutdown(context.Background())
 
 	node, timeout = channelReadString(managerTHREE.NodeLeave, 2)
 	if timeout {
@@ -155,7 +156,7 @@ func TestTwoClusterNode(t *testing.T) {
 		t.Errorf("expected Leave on managerTHREE to be from managerTWO, but got:%s", node)
 	}
 
-	managerTHREE.Shutdown()
+	managerTHREE.Shutdown(context.Background())
 
 }
 
@@ -310,7 +311,7 @@ func TestTreeNodeCluster(t *testing.T) {
 		}
 	}
 
-	managerSIX.Shutdown()
+	managerSIX.Shutdown(context.Background())
 
 	// quorum should be ok, we only lost 1 our of 3 nodes
 	quorum, timeout = channelReadBool(managerFOUR.QuorumState, 2)
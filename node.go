@@ -2,6 +2,7 @@ package cluster
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"net"
 	"sync"
@@ -15,11 +16,21 @@ type Node struct {
 	conn      net.Conn
 	reader    *bufio.Reader
 	writer    *bufio.Writer
+	writing   chan struct{} // held while writing, so a write deadline only applies to a single write
+	framing   framing
+	version   peerVersion
+	detector  *phiDetector
+	suspect   bool
 	quit      chan bool
 	quitOnce  *sync.Once
 	joinTime  time.Time
 	lag       time.Duration
+	rtt       time.Duration
+	offset    time.Duration // estimated offset of the clock of the node to ours
+	samples   []clockSample // last round trip measurements
+	skewed    bool          // wether the clock offset exceeds the maximum clock skew
 	packets   int64
+	unknown   int64 // received messages of unregistered types
 	statusStr string
 	errorStr  string
 	incomming bool
@@ -36,14 +47,20 @@ const (
 	StatusOnline = "Online"
 	// StatusLeaving is a node leaving
 	StatusLeaving = "Leaving"
+	// StatusSuspect is a node suspected to have failed, as it did not send a ping in time
+	StatusSuspect = "Suspect"
+	// StatusDraining is a node that is about to leave, and should no longer be given new work
+	StatusDraining = "Draining"
 )
 
-func newNode(name string, conn net.Conn, incomming bool) *Node {
+func newNode(name string, conn net.Conn, reader *bufio.Reader, framing framing, incomming bool) *Node {
 	newNode := &Node{
 		name:      name,
 		conn:      conn,
-		reader:    bufio.NewReader(conn),
+		reader:    reader,
 		writer:    bufio.NewWriter(conn),
+		writing:   make(chan struct{}, 1),
+		framing:   framing,
 		quit:      make(chan bool),
 		quitOnce:  new(sync.Once),
 		statusStr: StatusOffline,
@@ -64,19 +81,27 @@ func (n *Node) ioReader(packetManager chan Packet, timeoutDuration time.Duration
 			// Set a deadline for reading. Read operation will fail if no data is received after deadline.
 			n.conn.SetReadDeadline(time.Now().Add(timeoutDuration))
 
-			bytes, err := n.reader.ReadBytes('\n')
+			packet, err := n.framing.decode(n.reader)
 			if err != nil {
 				select {
 				case <-quit:
 					return fmt.Errorf("ioreader got quit signal for %s", n.name)
 				default:
 				}
-				return fmt.Errorf("error reading from %s (%s)", n.name, err)
+				return fmt.Errorf("error reading from %s (%s)", n.name, err) // also fail if we do not understand the packet
 			}
-			packet, err := UnpackPacket(bytes)
-			if err != nil {
-				return fmt.Errorf("unable to unpack packet: %s. disconnecting client", err) // fail if we do not understand the packet
+			packet.from = n
+			packet.received = time.Now() // before it waits in the queue of the packet manager, for the failure detector and clock
+			if packet.Sequence != 0 || packet.DataType == streamChunkType {
+				// reliable packets and stream chunks are not dropped, wait for the packet manager instead
+				select {
+				case packetManager <- *packet:
+				case <-quit:
+					return fmt.Errorf("ioreader got quit signal for %s", n.name)
+				}
+				continue
 			}
+
 			select {
 			case packetManager <- *packet:
 			default:
@@ -86,6 +111,80 @@ func (n *Node) ioReader(packetManager chan Packet, timeoutDuration time.Duration
 	}
 }
 
+// write sends a packet to the node, encoded with the framing of the connection
+func (n *Node) write(packet *Packet) error {
+	return n.writeEncoded(newEncodedPacket(packet))
+}
+
+// writeEncoded writes a packet that may be shared with the writes to other nodes
+func (n *Node) writeEncoded(packet *encodedPacket) error {
+	data, err := packet.encode(n.framing)
+	if err != nil {
+		return fmt.Errorf("unable to encode packet for %s: %s", n.name, err)
+	}
+
+	n.writing <- struct{}{}
+	defer func() { <-n.writing }()
+	_, err = n.conn.Write(data)
+	return err
+}
+
+// writeContext writes a packet, and aborts the write once ctx is done
+// A write that was aborted may have been written partially, so the connection is closed.
+// The packet is never written after writeContext returned.
+func (n *Node) writeContext(ctx context.Context, packet *encodedPacket) error {
+	data, err := packet.encode(n.framing)
+	if err != nil {
+		return fmt.Errorf("unable to encode packet for %s: %s", n.name, err)
+	}
+
+	select {
+	case n.writing <- struct{}{}:
+		defer func() { <-n.writing }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	deadline, _ := ctx.Deadline()
+	n.conn.SetWriteDeadline(deadline)
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			n.conn.SetWriteDeadline(time.Now()) // abort the write
+		case <-stop:
+		}
+	}()
+
+	_, err = n.conn.Write(data)
+	close(stop)
+	<-stopped
+	n.conn.SetWriteDeadline(time.Time{})
+	if err != nil {
+		n.close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded // the write deadline can pass before ctx notices
+		}
+	}
+
+	return err
+}
+
+// closed returns true once the connection to the node is closed
+func (n *Node) closed() bool {
+	select {
+	case <-n.quit:
+		return true
+	default:
+		return false
+	}
+}
+
 func (n *Node) close() {
 	n.quitOnce.Do(func() {
 		close(n.quit)
@@ -12,13 +12,54 @@ type Packet struct {
 	DataType    string    `json:"datatype"`
 	DataMessage string    `json:"datamessage"`
 	Time        time.Time `json:"time"`
+	RequestID   string    `json:"requestid,omitempty"`   // set on requests made with Call, and their responses
+	Response    bool      `json:"response,omitempty"`    // true if this packet is a response to a request
+	Error       string    `json:"error,omitempty"`       // error returned by the remote request handler
+	Sequence    uint64    `json:"sequence,omitempty"`    // set on packets sent with ToClusterReliable, which are acknowledged by the receiver
+	Topic       string    `json:"topic,omitempty"`       // set on packets sent with Publish
+	Compression string    `json:"compression,omitempty"` // compressor of the message on the wire, messages are decompressed when received
+
+	codec    string      // codec the message is encoded with
+	message  interface{} // message of a packet we send, to encode it with the codec of each connection
+	from     *Node       // connection a received packet was read from
+	received time.Time   // time a received packet was read from the connection
+}
+
+// receivedAt returns the time a packet was read from its connection, or now if it was not read from one
+func (p Packet) receivedAt() time.Time {
+	if p.received.IsZero() {
+		return time.Now()
+	}
+
+	return p.received
 }
 
 // Some predefined packets //
 
 // AuthRequestPacket defines an authorization request
 type packetAuthRequest struct {
-	AuthKey string `json:"authkey"`
+	Nonce        string   `json:"nonce"`
+	Codecs       []string `json:"codecs,omitempty"` // codecs supported by the dialer, in order of preference
+	Version      int      `json:"version,omitempty"`
+	Library      string   `json:"library,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Compressors  []string `json:"compressors,omitempty"` // compressors supported by the dialer
+}
+
+// AuthChallengePacket defines the challenge of the listening node, and its proof of knowing the authentication key
+type packetAuthChallenge struct {
+	Nonce        string   `json:"nonce"`
+	Proof        string   `json:"proof"`
+	Codec        string   `json:"codec,omitempty"` // codec picked for the connection, empty for the JSON newline format
+	Version      int      `json:"version,omitempty"`
+	Library      string   `json:"library,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Compressors  []string `json:"compressors,omitempty"` // compressors supported by the listener
+}
+
+// AuthProofPacket defines the proof of the connecting node of knowing the authentication key
+type packetAuthProof struct {
+	Proof string `json:"proof"`
 }
 
 // AuthResponsePacket defines an authorization response
@@ -32,15 +73,102 @@ type packetPing struct {
 	Time time.Time `json:"time"`
 }
 
+// PongPacket defines the answer to a ping
+type packetPong struct {
+	Ping     time.Time `json:"ping"`     // time the ping was sent
+	Received time.Time `json:"received"` // time the ping was received
+	Sent     time.Time `json:"sent"`     // time the pong was sent
+}
+
 // NodeShutdownPacket defines a node shutting down the cluster
 type packetNodeShutdown struct{}
 
+// NodeDrainPacket defines a node that is draining before it leaves the cluster
+type packetNodeDrain struct{}
+
+// ProbeRequestPacket asks a node to probe another node on our behalf
+type packetProbeRequest struct {
+	Node string `json:"node"`
+}
+
+// ProbeResponsePacket tells if a probed node was reachable
+type packetProbeResponse struct {
+	Reachable bool `json:"reachable"`
+}
+
+// ProbePacket defines a probe of a node
+type packetProbe struct{}
+
+// LeaderPacket defines a node claiming leadership of the cluster
+type packetLeader struct {
+	Leader string `json:"leader"`
+}
+
+// AckPacket defines the acknowledgement of a reliable packet
+type packetAck struct {
+	Sequence uint64 `json:"sequence"`
+}
+
+// KVUpdatePacket defines a change to the key/value store
+type packetKVUpdate struct {
+	Entry kvEntry `json:"entry"`
+}
+
+// KVSyncPacket defines the full state of the key/value store
+type packetKVSync struct {
+	Entries []kvEntry `json:"entries"`
+}
+
+// MembersPacket defines entries of the cluster membership
+type packetMembers struct {
+	Members []member `json:"members"`
+}
+
+// LockRequestPacket defines a lock request sent to the leader
+type packetLockRequest struct {
+	Action string        `json:"action"`
+	Name   string        `json:"name"`
+	Token  uint64        `json:"token,omitempty"`
+	TTL    time.Duration `json:"ttl,omitempty"`
+}
+
+// LockResponsePacket defines the response of the leader to a lock request
+type packetLockResponse struct {
+	Granted bool   `json:"granted"`
+	Token   uint64 `json:"token,omitempty"`
+	Holder  string `json:"holder,omitempty"`
+}
+
+// SubscriptionsPacket defines the topics a node subscribed to
+type packetSubscriptions struct {
+	Topics []string `json:"topics"`
+}
+
+// StreamChunkPacket defines a chunk of a stream
+type packetStreamChunk struct {
+	ID       string `json:"id"`
+	Offset   uint64 `json:"offset"`
+	Data     []byte `json:"data,omitempty"`
+	CRC      uint32 `json:"crc,omitempty"`      // crc32 of data
+	Final    bool   `json:"final,omitempty"`    // set on the chunk after the last data
+	Checksum string `json:"checksum,omitempty"` // sha256 of the stream, set on the final chunk
+	Abort    string `json:"abort,omitempty"`    // reason the sender stopped the stream
+}
+
+// StreamAckPacket defines the data of a stream read by the receiver
+type packetStreamAck struct {
+	ID     string `json:"id"`
+	Offset uint64 `json:"offset"`
+	Done   bool   `json:"done,omitempty"`  // set once the stream was finished by the receiver
+	Error  string `json:"error,omitempty"` // error of a stream that was not received completely
+}
+
 // Message returns the message of a packet
 func (packet *Packet) Message(message interface{}) error {
 	if packet == nil {
 		return fmt.Errorf("Unable to decrypt nil packet")
 	}
-	err := json.Unmarshal(json.RawMessage(packet.DataMessage), &message)
+	err := decodeMessage(packet.codec, packet.DataMessage, message)
 	if err != nil {
 		return fmt.Errorf("Failed to decrypt dataMessage:%v", err)
 	}
@@ -1,7 +1,6 @@
 package cluster
 
 import (
-	"crypto/tls"
 	"net"
 )
 
@@ -10,24 +9,20 @@ type server struct {
 	addr      string
 	close     chan bool
 	listener  net.Listener
-	tlsConfig *tls.Config
+	transport Transport
 }
 
-func newServer(addr string, tlsConfig *tls.Config) *server {
+func newServer(addr string, transport Transport) *server {
 	s := &server{
 		addr:      addr,
-		tlsConfig: tlsConfig,
+		transport: transport,
 	}
 	return s
 }
 
 // Listen creates the listener for the cluster server
 func (s *server) Listen() (ln net.Listener, err error) {
-	if len(s.tlsConfig.Certificates) == 0 {
-		s.listener, err = net.Listen("tcp", s.addr)
-	} else {
-		s.listener, err = tls.Listen("tcp", s.addr, s.tlsConfig)
-	}
+	s.listener, err = s.transport.Listen(s.addr)
 	if err != nil {
 		return
 	}
@@ -49,6 +44,11 @@ func (s *server) Serve(newSocket chan net.Conn, quit chan bool) {
 
 			continue
 		}
-		newSocket <- conn
+		select {
+		case newSocket <- conn:
+		case <-quit:
+			conn.Close()
+			return
+		}
 	}
 }
@@ -0,0 +1,93 @@
+package simulation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rdoorn/cluster"
+)
+
+// NewCluster starts a manager for each node on the network, with all nodes configured on each other
+func (n *Network) NewCluster(authKey string, settings cluster.Settings, nodes ...string) ([]*cluster.Manager, error) {
+	var managers []*cluster.Manager
+	for _, node := range nodes {
+		manager := cluster.NewManager(node, authKey)
+		manager.UpdateSettings(settings)
+		for _, remote := range nodes {
+			if remote != node {
+				manager.AddNode(remote, remote)
+			}
+		}
+
+		err := manager.ListenAndServeTransport(node, n.Transport(node))
+		if err != nil {
+			return managers, err
+		}
+		managers = append(managers, manager)
+	}
+
+	return managers, nil
+}
+
+// ExpectQuorum fails the test if manager does not report the quorum state within timeout
+// Other quorum states reported before are discarded
+func ExpectQuorum(t testing.TB, manager *cluster.Manager, quorum bool, timeout time.Duration) {
+	t.Helper()
+	deadline := time.After(timeout)
+	for {
+		select {
+		case state := <-manager.QuorumState:
+			if state == quorum {
+				return
+			}
+
+		case <-deadline:
+			t.Errorf("%s: expected quorum state %t within %s, but got none", manager.Name(), quorum, timeout)
+			return
+		}
+	}
+}
+
+// ExpectJoin fails the test if manager does not report node joining within timeout
+// Joins of other nodes reported before are discarded
+func ExpectJoin(t testing.TB, manager *cluster.Manager, node string, timeout time.Duration) {
+	t.Helper()
+	if !readNode(manager.NodeJoin, node, timeout) {
+		t.Errorf("%s: expected join of %s within %s, but got none", manager.Name(), node, timeout)
+	}
+}
+
+// ExpectLeave fails the test if manager does not report node leaving within timeout
+// Leaves of other nodes reported before are discarded
+func ExpectLeave(t testing.TB, manager *cluster.Manager, node string, timeout time.Duration) {
+	t.Helper()
+	if !readNode(manager.NodeLeave, node, timeout) {
+		t.Errorf("%s: expected leave of %s within %s, but got none", manager.Name(), node, timeout)
+	}
+}
+
+// ExpectNoLeave fails the test if manager reports any node leaving within duration
+func ExpectNoLeave(t testing.TB, manager *cluster.Manager, duration time.Duration) {
+	t.Helper()
+	select {
+	case node := <-manager.NodeLeave:
+		t.Errorf("%s: expected no node to leave within %s, but %s left", manager.Name(), duration, node)
+	case <-time.After(duration):
+	}
+}
+
+// readNode reads from channel until node is read, returns false if it was not read within timeout
+func readNode(channel chan string, node string, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case result := <-channel:
+			if result == node {
+				return true
+			}
+
+		case <-deadline:
+			return false
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package simulation
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// delayedPacket is a packet waiting for its latency to pass
+type delayedPacket struct {
+	due  time.Time
+	data []byte
+}
+
+// conn is a connection between two nodes, applying the faults of the network to each packet written
+// The cluster writes each packet with a single Write, so a write is handled as a packet
+type conn struct {
+	net.Conn
+	sync.Mutex
+	network   *Network
+	local     string             // node on this side of the connection
+	remote    string             // node on the other side of the connection
+	delayed   chan delayedPacket // packets delayed in order
+	startOnce sync.Once
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConn(c net.Conn, network *Network, local, remote string) *conn {
+	return &conn{
+		Conn:    c,
+		network: network,
+		local:   local,
+		remote:  remote,
+		delayed: make(chan delayedPacket, 1000),
+		closed:  make(chan struct{}),
+	}
+}
+
+// remoteNode returns the node on the other side of the connection
+func (c *conn) remoteNode() string {
+	c.Lock()
+	defer c.Unlock()
+	if c.remote == "" {
+		c.remote = c.network.dialer(c.Conn.RemoteAddr().String())
+	}
+
+	return c.remote
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	if !c.network.reachable(c.local, c.remoteNode()) {
+		return len(p), nil // lost in the partition
+	}
+
+	drop, latency, jitter := c.network.fault()
+	if drop {
+		return len(p), nil
+	}
+
+	if latency == 0 && jitter == 0 {
+		return c.Conn.Write(p)
+	}
+
+	data := append([]byte(nil), p...)
+	if jitter > 0 {
+		// each packet gets its own delay, so packets may overtake each other
+		time.AfterFunc(latency+jitter, func() {
+			c.Conn.Write(data)
+		})
+		return len(p), nil
+	}
+
+	c.startOnce.Do(func() {
+		go c.deliver()
+	})
+
+	select {
+	case c.delayed <- delayedPacket{due: time.Now().Add(latency), data: data}:
+	case <-c.closed:
+	}
+
+	return len(p), nil
+}
+
+// deliver writes the delayed packets in order once their latency passed
+func (c *conn) deliver() {
+	for {
+		select {
+		case packet := <-c.delayed:
+			time.Sleep(packet.due.Sub(time.Now()))
+			c.Conn.Write(packet.data)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,201 @@
+/*
+Package simulation implements a simulated network for testing clustered
+services under network faults.
+
+Nodes are connected using an in-process cluster.MemoryNetwork, where the
+address of each node is its name. Tests can partition sets of nodes, add
+latency, and drop or reorder packets, and heal the network again:
+
+ network := simulation.NewNetwork()
+ manager := cluster.NewManager("node1", "secret")
+ manager.AddNode("node2", "node2")
+ manager.ListenAndServeTransport("node1", network.Transport("node1"))
+
+ network.Partition("node1")         // node1 can no longer reach the other nodes
+ simulation.ExpectLeave(t, other, "node1", time.Second)
+ network.Cut("node1", "node2")      // only node1 and node2 can no longer reach each other
+ network.Heal()                     // all nodes can reach each other again
+*/
+package simulation
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rdoorn/cluster"
+)
+
+// Network is a simulated network between cluster nodes, which can inject faults
+type Network struct {
+	sync.Mutex
+	memory     *cluster.MemoryNetwork
+	partitions map[string]int    // partition of each node, nodes can only reach nodes in the same partition
+	lastGroup  int               // last partition created
+	cuts       map[string]bool   // links between two nodes that are cut
+	dialers    map[string]string // local address of dialed connections to the node that dialed them
+	latency    time.Duration     // delay of each packet
+	reorder    time.Duration     // maximum random additional delay of each packet, causing packets to reorder
+	dropRate   float64           // fraction of packets dropped
+	rand       *rand.Rand
+}
+
+// NewNetwork creates a new simulated network
+func NewNetwork() *Network {
+	n := &Network{
+		memory:     cluster.NewMemoryNetwork(),
+		partitions: make(map[string]int),
+		cuts:       make(map[string]bool),
+		dialers:    make(map[string]string),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	return n
+}
+
+// Seed sets the seed of the random faults, to make a test deterministic
+func (n *Network) Seed(seed int64) {
+	n.Lock()
+	defer n.Unlock()
+	n.rand = rand.New(rand.NewSource(seed))
+}
+
+// Transport returns the transport node should use to listen and connect to other nodes
+func (n *Network) Transport(node string) cluster.Transport {
+	return &transport{network: n, node: node}
+}
+
+// Partition isolates nodes from all other nodes, the nodes can still reach each other
+// Established connections stop passing packets, and new connections are refused
+func (n *Network) Partition(nodes ...string) {
+	n.Lock()
+	defer n.Unlock()
+	n.lastGroup++
+	for _, node := range nodes {
+		n.partitions[node] = n.lastGroup
+	}
+}
+
+// Cut breaks the link between nodes a and b, both can still reach all other nodes
+func (n *Network) Cut(a, b string) {
+	n.Lock()
+	defer n.Unlock()
+	n.cuts[link(a, b)] = true
+}
+
+// Heal removes all partitions and cut links
+func (n *Network) Heal() {
+	n.Lock()
+	defer n.Unlock()
+	n.partitions = make(map[string]int)
+	n.cuts = make(map[string]bool)
+}
+
+// SetLatency delays every packet by latency
+func (n *Network) SetLatency(latency time.Duration) {
+	n.Lock()
+	defer n.Unlock()
+	n.latency = latency
+}
+
+// SetReorder delays every packet by a random duration up to reorder, causing packets to arrive out of order
+func (n *Network) SetReorder(reorder time.Duration) {
+	n.Lock()
+	defer n.Unlock()
+	n.reorder = reorder
+}
+
+// SetDropRate drops the given fraction (0.0 - 1.0) of packets
+func (n *Network) SetDropRate(rate float64) {
+	n.Lock()
+	defer n.Unlock()
+	n.dropRate = rate
+}
+
+// reachable returns true if node a can reach node b
+func (n *Network) reachable(a, b string) bool {
+	n.Lock()
+	defer n.Unlock()
+	return n.partitions[a] == n.partitions[b] && !n.cuts[link(a, b)]
+}
+
+// link returns the name of the link between a and b, in either direction
+func link(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "/" + b
+}
+
+// fault returns if a packet should be dropped, and the delay of the packet if not
+func (n *Network) fault() (drop bool, latency, jitter time.Duration) {
+	n.Lock()
+	defer n.Unlock()
+	if n.dropRate > 0 && n.rand.Float64() < n.dropRate {
+		return true, 0, 0
+	}
+
+	if n.reorder > 0 {
+		jitter = time.Duration(n.rand.Int63n(int64(n.reorder)))
+	}
+
+	return false, n.latency, jitter
+}
+
+func (n *Network) addDialer(localAddr, node string) {
+	n.Lock()
+	defer n.Unlock()
+	n.dialers[localAddr] = node
+}
+
+func (n *Network) dialer(localAddr string) string {
+	n.Lock()
+	defer n.Unlock()
+	return n.dialers[localAddr]
+}
+
+// transport is the cluster.Transport of a single node
+type transport struct {
+	network *Network
+	node    string
+}
+
+func (t *transport) Listen(addr string) (net.Listener, error) {
+	l, err := t.network.memory.Listen(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &listener{Listener: l, network: t.network, node: t.node}, nil
+}
+
+func (t *transport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	if !t.network.reachable(t.node, addr) {
+		return nil, fmt.Errorf("dial %s: no route to host", addr)
+	}
+
+	conn, err := t.network.memory.Dial(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	t.network.addDialer(conn.LocalAddr().String(), t.node)
+	return newConn(conn, t.network, t.node, addr), nil
+}
+
+type listener struct {
+	net.Listener
+	network *Network
+	node    string
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	// the remote node is known once its dial returns
+	return newConn(conn, l.network, l.node, ""), nil
+}
@@ -0,0 +1,189 @@
+package simulation
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/rdoorn/cluster"
+)
+
+func testSettings() cluster.Settings {
+	return cluster.Settings{
+		PingInterval:    100 * time.Millisecond,
+		JoinDelay:       10 * time.Millisecond,
+		ReadTimeout:     500 * time.Millisecond,
+		ConnectInterval: 100 * time.Millisecond,
+		ConnectTimeout:  100 * time.Millisecond,
+		GossipInterval:  200 * time.Millisecond,
+	}
+}
+
+func TestPartition(t *testing.T) {
+	network := NewNetwork()
+	managers, err := network.NewCluster("secret", testSettings(), "simA", "simB", "simC")
+	if err != nil {
+		t.Fatalf("expected cluster to start, but got:%s", err)
+	}
+	a, b, c := managers[0], managers[1], managers[2]
+
+	ExpectJoin(t, a, "simC", 2*time.Second)
+	ExpectJoin(t, b, "simC", 2*time.Second)
+
+	// isolate simC, the majority keeps its quorum
+	network.Partition("simC")
+	ExpectLeave(t, a, "simC", 2*time.Second)
+	ExpectLeave(t, b, "simC", 2*time.Second)
+	ExpectQuorum(t, c, false, 2*time.Second)
+	ExpectQuorum(t, a, true, time.Second)
+
+	// heal the partition, simC joins again
+	network.Heal()
+	ExpectJoin(t, a, "simC", 2*time.Second)
+	ExpectJoin(t, b, "simC", 2*time.Second)
+	ExpectQuorum(t, c, true, 2*time.Second)
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
+
+func TestFailureDetector(t *testing.T) {
+	settings := testSettings()
+	settings.ReadTimeout = time.Minute
+	settings.SuspicionThreshold = 8
+	settings.FailureThreshold = 16
+
+	network := NewNetwork()
+	managers, err := network.NewCluster("secret", settings, "phiA", "phiB", "phiC")
+	if err != nil {
+		t.Fatalf("expected cluster to start, but got:%s", err)
+	}
+	a, b := managers[0], managers[1]
+
+	ExpectJoin(t, a, "phiC", 2*time.Second)
+	ExpectJoin(t, b, "phiC", 2*time.Second)
+	ExpectNoLeave(t, a, 500*time.Millisecond)
+
+	// pings of phiC no longer arrive, it is detected long before the read timeout
+	network.Partition("phiC")
+	ExpectLeave(t, a, "phiC", 2*time.Second)
+	ExpectLeave(t, b, "phiC", 2*time.Second)
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
+
+func TestIndirectProbe(t *testing.T) {
+	network := NewNetwork()
+	managers, err := network.NewCluster("secret", testSettings(), "probeA", "probeB", "probeC")
+	if err != nil {
+		t.Fatalf("expected cluster to start, but got:%s", err)
+	}
+	a, b, c := managers[0], managers[1], managers[2]
+
+	ExpectJoin(t, a, "probeC", 2*time.Second)
+	ExpectJoin(t, b, "probeC", 2*time.Second)
+	ExpectJoin(t, c, "probeA", 2*time.Second)
+
+	// only the link between probeA and probeC breaks, probeB can still reach both
+	network.Cut("probeA", "probeC")
+	ExpectNoLeave(t, a, time.Second)
+	ExpectNoLeave(t, c, 10*time.Millisecond)
+	ExpectQuorum(t, a, true, time.Second)
+
+	// once probeB can not reach probeC either, it is reported as failed
+	network.Partition("probeC")
+	ExpectLeave(t, a, "probeC", 2*time.Second)
+	ExpectLeave(t, b, "probeC", 2*time.Second)
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
+
+func TestLatencyAndReorder(t *testing.T) {
+	network := NewNetwork()
+	network.Seed(1)
+	managers, err := network.NewCluster("secret", testSettings(), "simD", "simE")
+	if err != nil {
+		t.Fatalf("expected cluster to start, but got:%s", err)
+	}
+	d, e := managers[0], managers[1]
+	ExpectJoin(t, d, "simE", 2*time.Second)
+
+	// latency below the read timeout does not cause nodes to leave
+	network.SetLatency(50 * time.Millisecond)
+	ExpectNoLeave(t, d, time.Second)
+
+	// messages still arrive when reordered
+	network.SetReorder(20 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		e.ToCluster <- "reordered"
+	}
+
+	for i := 0; i < 10; i++ {
+		select {
+		case <-d.FromCluster:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected 10 messages on simD, but got:%d", i)
+		}
+	}
+
+	// dropping all packets makes nodes leave
+	network.SetDropRate(1)
+	ExpectLeave(t, d, "simE", 2*time.Second)
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
+
+func TestStreamResume(t *testing.T) {
+	network := NewNetwork()
+	managers, err := network.NewCluster("secret", testSettings(), "simF", "simG")
+	if err != nil {
+		t.Fatalf("expected cluster to start, but got:%s", err)
+	}
+	f, g := managers[0], managers[1]
+	ExpectJoin(t, f, "simG", 2*time.Second)
+
+	data := make([]byte, 4*cluster.StreamWindow*cluster.StreamChunkSize)
+	rand.Read(data)
+
+	received := make(chan []byte, 1)
+	go func() {
+		stream := <-g.Streams
+		// read the first chunk, and cut the connection while the rest is in flight
+		first := make([]byte, cluster.StreamChunkSize)
+		io.ReadFull(stream, first)
+		network.Partition("simG")
+		ExpectLeave(t, f, "simG", 2*time.Second)
+		network.Heal()
+
+		rest, err := ioutil.ReadAll(stream)
+		if err != nil {
+			t.Errorf("expected stream to resume, but got:%s", err)
+		}
+		received <- append(first, rest...)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := f.SendStream(ctx, "simG", bytes.NewReader(data)); err != nil {
+		t.Errorf("expected stream to be sent after the partition healed, but got:%s", err)
+	}
+
+	if body := <-received; !bytes.Equal(body, data) {
+		t.Errorf("expected %d bytes on simG, but got:%d", len(data), len(body))
+	}
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
@@ -0,0 +1,41 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Transport creates the connections between cluster nodes
+type Transport interface {
+	Listen(addr string) (net.Listener, error)                  // listen for connections of other nodes on addr
+	Dial(addr string, timeout time.Duration) (net.Conn, error) // connect to the node listening on addr
+}
+
+// TCPTransport connects cluster nodes using plain tcp connections
+type TCPTransport struct{}
+
+// Listen creates a tcp listener
+func (t TCPTransport) Listen(addr string) (net.Listener, error) {
+	return net.Listen("tcp", addr)
+}
+
+// Dial creates a tcp connection
+func (t TCPTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, timeout)
+}
+
+// TLSTransport connects cluster nodes using tls connections
+type TLSTransport struct {
+	Config *tls.Config
+}
+
+// Listen creates a tls listener
+func (t TLSTransport) Listen(addr string) (net.Listener, error) {
+	return tls.Listen("tcp", addr, t.Config)
+}
+
+// Dial creates a tls connection
+func (t TLSTransport) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, "tcp", addr, t.Config)
+}
@@ -0,0 +1,229 @@
+package cluster
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// MemoryNetwork is an in-process Transport, connecting cluster nodes that use the same MemoryNetwork
+// Addresses are free form names, it is intended for simulating clusters in tests
+type MemoryNetwork struct {
+	sync.Mutex
+	listeners map[string]*memoryListener
+	lastPort  int
+}
+
+// NewMemoryNetwork creates a new in-process network
+func NewMemoryNetwork() *MemoryNetwork {
+	n := &MemoryNetwork{
+		listeners: make(map[string]*memoryListener),
+	}
+	return n
+}
+
+// Listen creates a listener on addr in the memory network
+func (n *MemoryNetwork) Listen(addr string) (net.Listener, error) {
+	n.Lock()
+	defer n.Unlock()
+	if _, ok := n.listeners[addr]; ok {
+		return nil, fmt.Errorf("listen %s: address already in use", addr)
+	}
+
+	l := &memoryListener{
+		network: n,
+		addr:    memoryAddr(addr),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[addr] = l
+	return l, nil
+}
+
+// Dial connects to the listener on addr in the memory network
+func (n *MemoryNetwork) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	n.Lock()
+	l, ok := n.listeners[addr]
+	n.lastPort++
+	local := memoryAddr(fmt.Sprintf("memory:%d", n.lastPort))
+	n.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dial %s: connection refused", addr)
+	}
+
+	// every connection is a pair of buffered pipes, one for each direction
+	toListener, toDialer := newMemoryPipe(), newMemoryPipe()
+	dialerConn := &memoryConn{in: toDialer, out: toListener, local: local, remote: l.addr}
+	listenerConn := &memoryConn{in: toListener, out: toDialer, local: l.addr, remote: local}
+
+	select {
+	case l.conns <- listenerConn:
+		return dialerConn, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("dial %s: connection refused", addr)
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("dial %s: i/o timeout", addr)
+	}
+}
+
+// memoryAddr is the address of a memory connection
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+type memoryListener struct {
+	network   *MemoryNetwork
+	addr      memoryAddr
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, fmt.Errorf("accept %s: use of closed listener", l.addr)
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.network.Lock()
+		delete(l.network.listeners, string(l.addr))
+		l.network.Unlock()
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// memoryPipe is a buffered, one directional stream of data
+type memoryPipe struct {
+	sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+	notify chan struct{} // signals a write or close to a waiting reader
+}
+
+func newMemoryPipe() *memoryPipe {
+	p := &memoryPipe{
+		notify: make(chan struct{}, 1),
+	}
+	return p
+}
+
+func (p *memoryPipe) read(b []byte, deadline time.Time) (int, error) {
+	for {
+		p.Lock()
+		if p.buf.Len() > 0 {
+			n, err := p.buf.Read(b)
+			p.Unlock()
+			return n, err
+		}
+
+		if p.closed {
+			p.Unlock()
+			return 0, io.EOF
+		}
+		p.Unlock()
+
+		if deadline.IsZero() {
+			<-p.notify
+			continue
+		}
+
+		wait := deadline.Sub(time.Now())
+		if wait <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.notify:
+			timer.Stop()
+		case <-timer.C:
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+func (p *memoryPipe) write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	p.buf.Write(b)
+	p.signal()
+	return len(b), nil
+}
+
+func (p *memoryPipe) close() {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	p.signal()
+}
+
+func (p *memoryPipe) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
+
+// memoryConn is a connection of the memory network, writes never block
+type memoryConn struct {
+	sync.Mutex
+	in           *memoryPipe
+	out          *memoryPipe
+	local        memoryAddr
+	remote       memoryAddr
+	readDeadline time.Time
+}
+
+func (c *memoryConn) Read(b []byte) (int, error) {
+	c.Lock()
+	deadline := c.readDeadline
+	c.Unlock()
+	return c.in.read(b, deadline)
+}
+
+func (c *memoryConn) Write(b []byte) (int, error) {
+	return c.out.write(b)
+}
+
+func (c *memoryConn) Close() error {
+	c.in.close()
+	c.out.close()
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return c.local }
+func (c *memoryConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+	c.readDeadline = t
+	return nil
+}
+
+func (c *memoryConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMemoryNetwork(t *testing.T) {
+	network := NewMemoryNetwork()
+	listener, err := network.Listen("node1")
+	if err != nil {
+		t.Fatalf("expected listen on memory network to work, but got:%s", err)
+	}
+
+	if _, err = network.Listen("node1"); err == nil {
+		t.Errorf("expected second listen on the same address to fail")
+	}
+
+	if _, err = network.Dial("node2", time.Second); err == nil {
+		t.Errorf("expected dial to an unknown address to fail")
+	}
+
+	accepted := make(chan error)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+
+		// echo the data back
+		data := make([]byte, 5)
+		_, err = io.ReadFull(conn, data)
+		if err == nil {
+			_, err = conn.Write(data)
+		}
+		conn.Close()
+		accepted <- err
+	}()
+
+	conn, err := network.Dial("node1", time.Second)
+	if err != nil {
+		t.Fatalf("expected dial on memory network to work, but got:%s", err)
+	}
+
+	conn.Write([]byte("hello"))
+	data := make([]byte, 5)
+	if _, err = io.ReadFull(conn, data); err != nil || string(data) != "hello" {
+		t.Errorf("expected echo of 'hello', but got:%s (%v)", data, err)
+	}
+
+	if err = <-accepted; err != nil {
+		t.Errorf("expected listener side to work, but got:%s", err)
+	}
+
+	// the remote closed the connection
+	if _, err = conn.Read(data); err != io.EOF {
+		t.Errorf("expected EOF after remote close, but got:%v", err)
+	}
+
+	// reads honour the deadline
+	conn2, err := network.Dial("node1", 10*time.Millisecond)
+	if err == nil {
+		conn2.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+		if _, err = conn2.Read(data); err == nil {
+			t.Errorf("expected read to timeout, but got data")
+		}
+	}
+
+	listener.Close()
+}
+
+func TestMemoryTransportCluster(t *testing.T) {
+	t.Parallel()
+
+	network := NewMemoryNetwork()
+	settings := defaultSetting()
+	settings.ConnectInterval = 100 * time.Millisecond
+	settings.JoinDelay = 10 * time.Millisecond
+	settings.GossipInterval = 200 * time.Millisecond
+
+	// all nodes only know the first node
+	var managers []*Manager
+	for i := 0; i < 10; i++ {
+		manager := NewManager(fmt.Sprintf("managerMemory%d", i), "secret")
+		manager.UpdateSettings(settings)
+		if i > 0 {
+			manager.AddNode("managerMemory0", "memory0")
+		}
+
+		err := manager.ListenAndServeTransport(fmt.Sprintf("memory%d", i), network)
+		if err != nil {
+			t.Fatalf("expected listen on memory network to work, but got:%s", err)
+		}
+		managers = append(managers, manager)
+	}
+
+	connected := waitFor(10*time.Second, func() bool {
+		for _, manager := range managers {
+			if manager.connectedNodes.count() != len(managers)-1 {
+				return false
+			}
+		}
+		return true
+	})
+	if !connected {
+		for _, manager := range managers {
+			t.Errorf("expected %s to be connected to all nodes, but got:%v", manager.Name(), manager.connectedNodes.nodeNames())
+		}
+	}
+
+	for _, manager := range managers {
+		if !manager.quorum() {
+			t.Errorf("expected %s to have quorum", manager.Name())
+		}
+	}
+
+	for _, manager := range managers {
+		manager.Shutdown(context.Background())
+	}
+}
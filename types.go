@@ -0,0 +1,150 @@
+package cluster
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// The data type of a packet names the type of its message. By default this is
+// the Go type path of the message (e.g. main.CustomMessage), which changes when
+// the type is renamed or moved to another package. Types registered with
+// RegisterType are sent with their registered name instead, and received under
+// their name or any of their aliases, so nodes running different builds keep
+// understanding each other.
+
+var types = struct {
+	sync.RWMutex
+	names   map[reflect.Type]string // registered name per type
+	types   map[string]reflect.Type // type per registered name
+	aliases map[string]string       // registered name per alias
+}{
+	names:   make(map[reflect.Type]string),
+	types:   make(map[string]reflect.Type),
+	aliases: make(map[string]string),
+}
+
+func init() {
+	for name, prototype := range map[string]interface{}{
+		"cluster.packetAuthRequest":   packetAuthRequest{},
+		"cluster.packetAuthChallenge": packetAuthChallenge{},
+		"cluster.packetAuthProof":     packetAuthProof{},
+		"cluster.packetAuthResponse":  packetAuthResponse{},
+		"cluster.packetPing":          packetPing{},
+		"cluster.packetPong":          packetPong{},
+		"cluster.packetNodeShutdown":  packetNodeShutdown{},
+		"cluster.packetNodeDrain":     packetNodeDrain{},
+		"cluster.packetProbeRequest":  packetProbeRequest{},
+		"cluster.packetProbeResponse": packetProbeResponse{},
+		"cluster.packetProbe":         packetProbe{},
+		"cluster.packetLeader":        packetLeader{},
+		"cluster.packetAck":           packetAck{},
+		"cluster.packetKVUpdate":      packetKVUpdate{},
+		"cluster.packetKVSync":        packetKVSync{},
+		"cluster.packetMembers":       packetMembers{},
+		"cluster.packetLockRequest":   packetLockRequest{},
+		"cluster.packetLockResponse":  packetLockResponse{},
+		"cluster.packetSubscriptions": packetSubscriptions{},
+		streamChunkType:               packetStreamChunk{},
+		"cluster.packetStreamAck":     packetStreamAck{},
+	} {
+		if err := RegisterType(name, prototype); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterType registers the name messages of the same type as prototype are sent as
+// Messages received with the name or one of the aliases are passed on with the
+// registered name, use aliases for names the type was sent as by older builds.
+// It fails if the name or an alias is already used by another type.
+func RegisterType(name string, prototype interface{}, aliases ...string) error {
+	if name == "" || prototype == nil {
+		return fmt.Errorf("unable to register a type without name or prototype")
+	}
+
+	t := indirectType(prototype)
+	types.Lock()
+	defer types.Unlock()
+	if registered, ok := types.names[t]; ok && registered != name {
+		return fmt.Errorf("type %s is already registered as %s", t, registered)
+	}
+
+	for _, n := range append([]string{name}, aliases...) {
+		if other, ok := types.types[n]; ok && other != t {
+			return fmt.Errorf("type name %s is already registered for %s", n, other)
+		}
+		if registered, ok := types.aliases[n]; ok && registered != name {
+			return fmt.Errorf("type name %s is already an alias of %s", n, registered)
+		}
+	}
+
+	types.names[t] = name
+	types.types[name] = t
+	for _, alias := range aliases {
+		if alias != name {
+			types.aliases[alias] = name
+		}
+	}
+	return nil
+}
+
+// UnknownTypeEvent is sent when a node sent a message of a type not registered with RegisterType
+type UnknownTypeEvent struct {
+	Node     string
+	DataType string
+	Dropped  bool // true if the message was dropped because of Settings.StrictTypes
+}
+
+// RegisteredType returns the type registered for a name or alias
+func RegisteredType(name string) (reflect.Type, bool) {
+	types.RLock()
+	defer types.RUnlock()
+	if registered, ok := types.aliases[name]; ok {
+		name = registered
+	}
+
+	t, ok := types.types[name]
+	return t, ok
+}
+
+// resolveType returns the registered name of a received data type, and false if the type is unknown
+func resolveType(dataType string) (string, bool) {
+	types.RLock()
+	defer types.RUnlock()
+	if registered, ok := types.aliases[dataType]; ok {
+		return registered, true
+	}
+
+	_, ok := types.types[dataType]
+	return dataType, ok
+}
+
+// dataTypeOf returns the data type a message is sent as
+func dataTypeOf(message interface{}) string {
+	t := indirectType(message)
+	types.RLock()
+	defer types.RUnlock()
+	if name, ok := types.names[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("%s", t)
+}
+
+func indirectType(message interface{}) reflect.Type {
+	t := reflect.TypeOf(message)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// unknownType counts a received message of an unregistered type, and reports it to the client application
+func (m *Manager) unknownType(packet Packet, dropped bool) {
+	m.connectedNodes.incUnknownTypes(packet.Name)
+	select {
+	case m.UnknownType <- UnknownTypeEvent{Node: packet.Name, DataType: packet.DataType, Dropped: dropped}: // warning to client application
+	default:
+	}
+}
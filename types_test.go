@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+)
+
+type typedMessage struct {
+	Value string `json:"value"`
+}
+
+type unregisteredMessage struct {
+	Value string `json:"value"`
+}
+
+type strictMessage struct {
+	Value string `json:"value"`
+}
+
+type conflictingMessage struct{}
+
+func TestRegisterType(t *testing.T) {
+	if err := RegisterType("test.typed", typedMessage{}, "test.typedOld"); err != nil {
+		t.Fatalf("expected type to register, but got:%s", err)
+	}
+
+	if name := dataTypeOf(&typedMessage{}); name != "test.typed" {
+		t.Errorf("expected registered name test.typed, but got:%s", name)
+	}
+
+	if name := dataTypeOf(unregisteredMessage{}); name != "cluster.unregisteredMessage" {
+		t.Errorf("expected go type path for unregistered type, but got:%s", name)
+	}
+
+	for _, name := range []string{"test.typed", "test.typedOld"} {
+		if resolved, known := resolveType(name); resolved != "test.typed" || !known {
+			t.Errorf("expected %s to resolve to test.typed, but got:%s %t", name, resolved, known)
+		}
+	}
+
+	if _, known := resolveType("cluster.unregisteredMessage"); known {
+		t.Errorf("expected unregistered type to be unknown")
+	}
+
+	if err := RegisterType("test.typedOld", conflictingMessage{}); err == nil {
+		t.Errorf("expected registering an alias of another type to fail")
+	}
+
+	if err := RegisterType("test.renamed", typedMessage{}); err == nil {
+		t.Errorf("expected registering a type twice under a different name to fail")
+	}
+}
+
+func TestStrictTypes(t *testing.T) {
+	t.Parallel()
+	if err := RegisterType("test.strict", strictMessage{}, "test.strictOld"); err != nil {
+		t.Fatalf("expected type to register, but got:%s", err)
+	}
+
+	managers := startMemoryCluster(t, "managerTypes", 2)
+
+	sender, receiver := managers[0], managers[1]
+	receiver.mu.Lock()
+	receiver.settings.StrictTypes = true
+	receiver.mu.Unlock()
+	if !waitFor(5*time.Second, func() bool { return len(sender.connectedNodes.getAllNodes()) == 1 }) {
+		t.Fatalf("expected managers to connect")
+	}
+
+	// unregistered types are dropped
+	sender.ToCluster <- unregisteredMessage{Value: "dropped"}
+	select {
+	case packet := <-receiver.FromCluster:
+		t.Errorf("expected unregistered type to be dropped, but got:%+v", packet)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	select {
+	case event := <-receiver.UnknownType:
+		if event.Node != "managerTypes0" || event.DataType != "cluster.unregisteredMessage" || !event.Dropped {
+			t.Errorf("expected the dropped message to be reported, but got:%+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected an UnknownType event for the dropped message")
+	}
+
+	receiver.connectedNodes.RLock()
+	unknown := receiver.connectedNodes.nodes["managerTypes0"].unknown
+	receiver.connectedNodes.RUnlock()
+	if unknown != 1 {
+		t.Errorf("expected 1 message of an unknown type from managerTypes0, but got:%d", unknown)
+	}
+
+	// an older build sending the alias
+	packet := sender.packetFor(strictMessage{Value: "alias"})
+	packet.DataType = "test.strictOld"
+	if err := sender.connectedNodes.write("managerTypes1", packet); err != nil {
+		t.Fatalf("expected write to succeed, but got:%s", err)
+	}
+
+	received, timeout := channelReadPacket(receiver.FromCluster, 2)
+	if timeout {
+		t.Fatalf("expected packet sent with alias, but got timeout")
+	}
+
+	message := &strictMessage{}
+	if err := received.Message(message); err != nil || received.DataType != "test.strict" || message.Value != "alias" {
+		t.Errorf("expected message alias of type test.strict, but got:%+v %v", received, err)
+	}
+}
@@ -0,0 +1,83 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Nodes exchange their protocol version, library version and capabilities
+// during the handshake. A node rejects peers speaking a protocol older than
+// MinProtocolVersion, and only uses features both sides advertised, so a
+// cluster can be upgraded one node at a time.
+//
+// Version 1 is the challenge/response handshake without version information,
+// nodes sending no version are assumed to speak it. Nodes from before this
+// handshake can not authenticate at all, there is no rolling upgrade from them.
+
+const (
+	// ProtocolVersion is the version of the cluster protocol spoken by this library
+	ProtocolVersion = 2
+	// MinProtocolVersion is the oldest protocol version of other nodes we can communicate with
+	MinProtocolVersion = 1
+	// LibraryVersion is the version of this library, shared with other nodes for diagnostics
+	LibraryVersion = "0.2.0"
+)
+
+const (
+	// CapabilityCodec is set by nodes supporting binary frames with a negotiated codec
+	CapabilityCodec = "codec"
+	// CapabilityReliable is set by nodes acknowledging packets sent with ToClusterReliable
+	CapabilityReliable = "reliable"
+	// CapabilityCompression is set by nodes decompressing compressed messages
+	CapabilityCompression = "compression"
+	// CapabilityRTT is set by nodes answering pings with a pong
+	CapabilityRTT = "rtt"
+)
+
+// capabilities returns the capabilities of this library
+func capabilities() []string {
+	return []string{CapabilityCodec, CapabilityCompression, CapabilityReliable, CapabilityRTT}
+}
+
+// peerVersion is the version information a node sent during the handshake
+type peerVersion struct {
+	protocol     int
+	library      string
+	capabilities map[string]bool
+}
+
+func newPeerVersion(protocol int, library string, capabilities []string) peerVersion {
+	if protocol == 0 {
+		protocol = 1 // nodes sending no version predate versioning
+	}
+
+	v := peerVersion{
+		protocol:     protocol,
+		library:      library,
+		capabilities: make(map[string]bool),
+	}
+	for _, capability := range capabilities {
+		v.capabilities[capability] = true
+	}
+
+	return v
+}
+
+// compatible returns an error if we can not communicate with a node of this version
+func (v peerVersion) compatible(minProtocolVersion int) error {
+	if v.protocol < minProtocolVersion {
+		return fmt.Errorf("incompatible protocol version %d (library %q), at least version %d is required", v.protocol, v.library, minProtocolVersion)
+	}
+
+	return nil
+}
+
+// capabilityList returns the capabilities as a sorted list
+func (v peerVersion) capabilityList() (list []string) {
+	for capability := range v.capabilities {
+		list = append(list, capability)
+	}
+
+	sort.Strings(list)
+	return
+}